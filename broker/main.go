@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// The broker holds the world uploaded by a controller and divides every turn between remote workers.
+// Start the workers first, e.g.
+//
+//	go run ./worker -port 8031 &
+//	go run ./worker -port 8032 &
+//	go run ./broker -port 8030 -workers localhost:8031,localhost:8032
+//	go run . -broker localhost:8030
+//
+// More workers can join while the broker is running, and leave again when interrupted, e.g.
+//
+//	go run ./worker -port 8033 -broker localhost:8030
+func main() {
+	port := flag.Int(
+		"port",
+		8030,
+		"Specify the port to serve controllers on.")
+
+	workers := flag.String(
+		"workers",
+		"localhost:8031",
+		"Specify the addresses of the workers, separated by commas. Leave empty to wait for workers to register.")
+
+	flag.Parse()
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%v", *port))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Broker listening on", l.Addr())
+	var addresses []string
+	if *workers != "" {
+		addresses = strings.Split(*workers, ",")
+	}
+	if err := gol.ServeBroker(l, addresses); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestCells tests reading and writing patterns in the plaintext and Life 1.06 formats.
+func TestCells(t *testing.T) {
+	t.Run("Plaintext", testCellsPlaintext)
+	t.Run("Life106", testCellsLife106)
+	t.Run("RoundTrip", testCellsRoundTrip)
+	t.Run("Invalid", testCellsInvalid)
+}
+
+func testCellsPlaintext(t *testing.T) {
+	// rows may leave out trailing dead cells
+	path := writePattern(t, "glider.cells", "!Name: Glider\n!\n.O\n..O\nOOO\n")
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, InputFile: path}
+	cells := runFinal(p)
+	assertEqualBoard(t, cells, gliderAt(6, 6), p)
+
+	// without a size the world is as big as the pattern
+	cells = runFinal(gol.Params{InputFile: path})
+	assertEqualBoard(t, cells, gliderAt(0, 0), gol.Params{ImageWidth: 3, ImageHeight: 3})
+}
+
+func testCellsLife106(t *testing.T) {
+	// coordinates are positions in the world
+	path := writePattern(t, "glider.lif", "#Life 1.06\n5 3\n6 4\n4 5\n5 5\n6 5\n")
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, InputFile: path}
+	cells := runFinal(p)
+	assertEqualBoard(t, cells, gliderAt(4, 3), p)
+
+	// patterns with negative coordinates are centred
+	path = writePattern(t, "glider.lif", "#Life 1.06\n0 -1\n1 0\n-1 1\n0 1\n1 1\n")
+	cells = runFinal(gol.Params{ImageWidth: 16, ImageHeight: 16, InputFile: path})
+	assertEqualBoard(t, cells, gliderAt(6, 6), p)
+
+	p.PatternOffset = &util.Cell{X: 2, Y: 10}
+	p.InputFile = path
+	cells = runFinal(p)
+	assertEqualBoard(t, cells, gliderAt(2, 10), p)
+}
+
+func testCellsRoundTrip(t *testing.T) {
+	for _, format := range []string{"cells", "lif"} {
+		for _, turns := range []int{0, 1, 100} {
+			t.Run(fmt.Sprintf("%v/16x16x%d", format, turns), func(t *testing.T) {
+				emptyOutFolder()
+				p := gol.Params{Turns: turns, Threads: 4, ImageWidth: 16, ImageHeight: 16, OutputFormat: format}
+				runFinal(p)
+
+				path := fmt.Sprintf("out/16x16x%v.%v", turns, format)
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if format == "lif" {
+					assert(t, strings.HasPrefix(string(data), "#Life 1.06\n"), "the output should start with #Life 1.06, not %q", data)
+				}
+
+				cells := runFinal(gol.Params{Threads: 4, ImageWidth: 16, ImageHeight: 16, InputFile: path})
+				expected := readAliveCells(fmt.Sprintf("check/images/16x16x%v.pgm", turns), 16, 16)
+				assertEqualBoard(t, cells, expected, p)
+			})
+		}
+	}
+}
+
+func testCellsInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"glider.cells": ".O.\n..X\nOOO\n",
+		"header.lif":   "1 0\n2 1\n",
+		"number.lif":   "#Life 1.06\n1 zero\n",
+		"extra.lif":    "#Life 1.06\n1 0 2\n",
+		"too big.lif":  "#Life 1.06\n0 0\n20 20\n",
+	}
+	for name, data := range invalid {
+		t.Run(name, func(t *testing.T) {
+			expectRefused(t, gol.Params{ImageWidth: 16, ImageHeight: 16, InputFile: writePattern(t, name, data)})
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestCheckpoint tests writing checkpoints and resuming runs from them.
+func TestCheckpoint(t *testing.T) {
+	t.Run("Resume", testCheckpointResume)
+	t.Run("Periodic", testCheckpointPeriodic)
+	t.Run("Invalid", testCheckpointInvalid)
+}
+
+func testCheckpointResume(t *testing.T) {
+	emptyOutFolder()
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16, Engine: gol.PackedEngine}
+
+	// quitting writes a checkpoint of the current turn
+	_, _, final := runKeys(t, p, "pnnnnnq")
+	assert(t, final == 5, "FinalTurnComplete should have a CompletedTurns of 5, not %v", final)
+	saved, turn, err := gol.CheckpointParams("out/16x16.checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, turn == 5, "the checkpoint should be at turn 5, not %v", turn)
+	assert(t, saved.Turns == 100 && saved.Threads == 4 && saved.Engine == gol.PackedEngine,
+		"the checkpoint should keep the params of the run, not %+v", saved)
+	assert(t, saved.ImageWidth == 16 && saved.ImageHeight == 16, "the checkpoint should be 16x16, not %vx%v", saved.ImageWidth, saved.ImageHeight)
+
+	// the resumed run carries on from turn 5
+	resumed := gol.Params{Turns: 100, Threads: 4, Resume: "out/16x16.checkpoint"}
+	turns, _, final := runKeys(t, resumed, "")
+	assert(t, len(turns) > 0 && turns[0] == 6, "the first TurnComplete should be for turn 6, not %v", turns)
+	assert(t, final == 100, "FinalTurnComplete should have a CompletedTurns of 100, not %v", final)
+	cells := runFinal(resumed)
+	assertEqualBoard(t, cells, readAliveCells("check/images/16x16x100.pgm", 16, 16), p)
+}
+
+func testCheckpointPeriodic(t *testing.T) {
+	emptyOutFolder()
+	p := gol.Params{Turns: 100000000, Threads: 8, ImageWidth: 512, ImageHeight: 512, CheckpointInterval: 100 * time.Millisecond}
+	keyPresses := make(chan rune, 1)
+	events := make(chan gol.Event, 1000)
+	go gol.Run(p, events, keyPresses)
+
+	time.Sleep(500 * time.Millisecond)
+	keyPresses <- 'k'
+	for range events {
+	}
+	_, turn, err := gol.CheckpointParams("out/512x512.checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, turn > 0, "a checkpoint should have been written after turn 0")
+
+	// the checkpoint holds the world of its turn
+	alive := readAliveCounts(512, 512)
+	cells := runFinal(gol.Params{Turns: turn, Threads: 8, Resume: "out/512x512.checkpoint"})
+	if turn <= 10000 {
+		assert(t, len(cells) == alive[turn], "At turn %v expected %v alive cells in the checkpoint, got %v instead", turn, alive[turn], len(cells))
+	}
+}
+
+func testCheckpointInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"missing": "x = 3, y = 3\nbob$2bo$3o!\n",
+		"turn":    "#C gol checkpoint: turn = -1, turns = 10\nx = 3, y = 3\nbob$2bo$3o!\n",
+		"engine":  "#C gol checkpoint: turn = 1, engine = fast\nx = 3, y = 3\nbob$2bo$3o!\n",
+		"pattern": "#C gol checkpoint: turn = 1\nx = 3, y = 3\nbob$2bo$3o\n",
+	}
+	for name, data := range invalid {
+		t.Run(name, func(t *testing.T) {
+			path := writePattern(t, "pattern.checkpoint", data)
+			if _, _, err := gol.CheckpointParams(path); err == nil {
+				t.Errorf("ERROR: reading the params of an invalid checkpoint should fail")
+			}
+			expectRefused(t, gol.Params{Turns: 10, Resume: path})
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestCompress tests writing gzipped images and checkpoints and reading gzipped inputs.
+func TestCompress(t *testing.T) {
+	t.Run("Images", testCompressImages)
+	t.Run("Checkpoint", testCompressCheckpoint)
+	t.Run("Input", testCompressInput)
+}
+
+func testCompressImages(t *testing.T) {
+	for _, format := range []string{"pgm", "pbm", "rle"} {
+		t.Run(format, func(t *testing.T) {
+			emptyOutFolder()
+			p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 512, ImageHeight: 512, OutputFormat: format, Compress: true}
+			runFinal(p)
+
+			path := fmt.Sprintf("out/512x512x100.%v.gz", format)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert(t, len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b, "%v should start with the gzip magic number", path)
+			_, err = os.Stat(fmt.Sprintf("out/512x512x100.%v", format))
+			assert(t, os.IsNotExist(err), "only the compressed image should be written")
+
+			cells := runFinal(gol.Params{Threads: 4, InputFile: path})
+			assertEqualBoard(t, cells, readAliveCells("check/images/512x512x100.pgm", 512, 512), p)
+		})
+	}
+}
+
+func testCompressCheckpoint(t *testing.T) {
+	emptyOutFolder()
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16, Compress: true}
+	runKeys(t, p, "pnnnq")
+	saved, turn, err := gol.CheckpointParams("out/16x16.checkpoint.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, turn == 3, "the checkpoint should be at turn 3, not %v", turn)
+	assert(t, saved.ImageWidth == 16 && saved.ImageHeight == 16, "the checkpoint should be 16x16, not %vx%v", saved.ImageWidth, saved.ImageHeight)
+
+	cells := runFinal(gol.Params{Turns: 100, Threads: 4, Resume: "out/16x16.checkpoint.gz"})
+	assertEqualBoard(t, cells, readAliveCells("check/images/16x16x100.pgm", 16, 16), p)
+}
+
+func testCompressInput(t *testing.T) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	fmt.Fprint(w, glider)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the format comes from the extension before .gz
+	path := writePattern(t, "glider.RLE.gz", compressed.String())
+	p := gol.Params{ImageWidth: 8, ImageHeight: 8, InputFile: path, PatternOffset: &util.Cell{X: 1, Y: 1}}
+	cells := runFinal(p)
+	assertEqualBoard(t, cells, gliderAt(1, 1), p)
+
+	width, height, err := gol.ImageSize(path)
+	assert(t, err == nil && width == 3 && height == 3, "the size of the pattern should be 3x3, not %vx%v (%v)", width, height, err)
+
+	// a file ending in .gz that is not gzipped can not be read
+	path = writePattern(t, "glider.rle.gz", glider)
+	_, _, err = gol.ImageSize(path)
+	assert(t, err != nil, "reading a file ending in .gz that is not compressed should fail")
+}
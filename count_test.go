@@ -79,6 +79,43 @@ func TestAlive(t *testing.T) {
 	}
 }
 
+// TestAliveInterval checks that the alive cell counts follow the ReportInterval and stop with the final turn.
+func TestAliveInterval(t *testing.T) {
+	p := gol.Params{
+		Turns:          100000000,
+		Threads:        8,
+		ImageWidth:     512,
+		ImageHeight:    512,
+		ReportInterval: 50 * time.Millisecond,
+	}
+	alive := readAliveCounts(p.ImageWidth, p.ImageHeight)
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 2)
+	go gol.Run(p, events, keyPresses)
+
+	start := time.Now()
+	counts := 0
+	final := false
+	for event := range events {
+		switch e := event.(type) {
+		case gol.AliveCellsCount:
+			assert(t, !final, "AliveCellsCount should not be sent after FinalTurnComplete")
+			if e.CompletedTurns <= 10000 {
+				assert(t, e.CellsCount == alive[e.CompletedTurns], "At turn %v expected %v alive cells, got %v instead",
+					e.CompletedTurns, alive[e.CompletedTurns], e.CellsCount)
+			}
+			counts++
+			if counts == 5 {
+				assert(t, time.Since(start) < time.Second, "5 AliveCellsCount events took %v with a 50ms interval", time.Since(start))
+				keyPresses <- 'q'
+			}
+		case gol.FinalTurnComplete:
+			final = true
+		}
+	}
+	assert(t, counts >= 5, "Expected at least 5 AliveCellsCount events, got %v", counts)
+}
+
 func readAliveCounts(width, height int) map[int]int {
 	f, err := os.Open("check/alive/" + fmt.Sprintf("%vx%v.csv", width, height))
 	util.Check(err)
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestDistributed tests processing the turns on remote workers through a broker, all on localhost ports.
+func TestDistributed(t *testing.T) {
+	t.Run("Images", testDistributedImages)
+	t.Run("Topologies", testDistributedTopologies)
+	t.Run("Workers", testDistributedWorkers)
+	t.Run("Keys", testDistributedKeys)
+	t.Run("Detach", testDistributedDetach)
+	t.Run("AttachTopology", testDistributedAttachTopology)
+	t.Run("Takeover", testDistributedTakeover)
+	t.Run("Stop", testDistributedStop)
+	t.Run("WorkerFailure", testDistributedWorkerFailure)
+	t.Run("HungWorker", testDistributedHungWorker)
+	t.Run("Heartbeat", testDistributedHeartbeat)
+	t.Run("Registration", testDistributedRegistration)
+	t.Run("HashLife", testDistributedHashLife)
+	t.Run("NoBroker", testDistributedNoBroker)
+}
+
+// listen returns a listener on a free localhost port, which is closed at the end of the test.
+func listen(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// startBroker starts a broker with the given number of workers, returning its address.
+func startBroker(t *testing.T, workers int) string {
+	return startBrokerWith(t, startWorkers(t, workers))
+}
+
+// startWorkers starts the given number of workers, returning their addresses.
+func startWorkers(t *testing.T, workers int) []string {
+	var addresses []string
+	for i := 0; i < workers; i++ {
+		l := listen(t)
+		go gol.ServeWorker(l)
+		addresses = append(addresses, l.Addr().String())
+	}
+	return addresses
+}
+
+// startBrokerWith starts a broker with the workers at the addresses, returning its address.
+func startBrokerWith(t *testing.T, addresses []string) string {
+	l := listen(t)
+	go func() {
+		if err := gol.ServeBroker(l, addresses); err != nil {
+			t.Error(err)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func testDistributedImages(t *testing.T) {
+	broker := startBroker(t, 3)
+	for _, size := range []int{16, 64, 512} {
+		for _, turns := range []int{0, 1, 100} {
+			t.Run(fmt.Sprintf("%dx%dx%d", size, size, turns), func(t *testing.T) {
+				p := gol.Params{Turns: turns, ImageWidth: size, ImageHeight: size, Broker: broker}
+				cells := runFinal(p)
+				expected := readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", size, size, turns), size, size)
+				assertEqualBoard(t, cells, expected, p)
+			})
+		}
+	}
+}
+
+func testDistributedTopologies(t *testing.T) {
+	broker := startBroker(t, 4)
+	for _, engine := range []gol.Engine{gol.ByteEngine, gol.PackedEngine} {
+		for _, topology := range []gol.Topology{gol.Plane, gol.KleinBottle, gol.CrossSurface} {
+			t.Run(fmt.Sprintf("%v/%v", engine, topology), func(t *testing.T) {
+				p := gol.Params{Turns: 50, Threads: 4, ImageWidth: 64, ImageHeight: 64, Engine: engine, Topology: topology}
+				expected := runFinal(p)
+				p.Broker = broker
+				assertEqualBoard(t, runFinal(p), expected, p)
+			})
+		}
+	}
+}
+
+func testDistributedWorkers(t *testing.T) {
+	// a single worker is its own neighbour, and five workers give strips of different heights
+	for _, workers := range []int{1, 2, 5} {
+		broker := startBroker(t, workers)
+		for _, engine := range []gol.Engine{gol.ByteEngine, gol.PackedEngine} {
+			t.Run(fmt.Sprintf("%v/%v", workers, engine), func(t *testing.T) {
+				p := gol.Params{Turns: 100, ImageWidth: 64, ImageHeight: 64, Engine: engine, Topology: gol.CrossSurface}
+				expected := runFinal(p)
+				p.Broker = broker
+				assertEqualBoard(t, runFinal(p), expected, p)
+			})
+		}
+	}
+}
+
+func testDistributedKeys(t *testing.T) {
+	broker := startBroker(t, 2)
+	p := gol.Params{Turns: 100, ImageWidth: 16, ImageHeight: 16, Broker: broker}
+
+	// stepping back restarts the simulation on the broker with the earlier world
+	turns, _, final := runKeys(t, p, "pnnnbq")
+	assert(t, final == 2, "FinalTurnComplete should have a CompletedTurns of 2, not %v", final)
+	assert(t, len(turns) == 4 && turns[3] == 2, "the turns should be 1, 2, 3 and 2, not %v", turns)
+
+	// quitting left the broker to carry on from the earlier world
+	_, final, cells := runAttached(gol.Params{Broker: broker, Attach: true, Turns: 100})
+	assert(t, final == 100, "FinalTurnComplete should have a CompletedTurns of 100, not %v", final)
+	assertEqualBoard(t, cells, readAliveCells("check/images/16x16x100.pgm", 16, 16), p)
+
+	// the broker can be used again once a run is over
+	cells = runFinal(p)
+	assertEqualBoard(t, cells, readAliveCells("check/images/16x16x100.pgm", 16, 16), p)
+}
+
+func testDistributedStop(t *testing.T) {
+	workers := startWorkers(t, 2)
+	p := gol.Params{Turns: 10, ImageWidth: 16, ImageHeight: 16, Broker: startBrokerWith(t, workers)}
+	runFinal(p)
+
+	// the run is stopped once it is over, so the workers should no longer have strips
+	for _, address := range workers {
+		client, err := rpc.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.Call("RemoteWorker.Rows", gol.RowsRequest{}, &gol.RowsResponse{})
+		client.Close()
+		assert(t, err != nil, "worker %v should have dropped its strip once the run was stopped", address)
+	}
+}
+
+func testDistributedHashLife(t *testing.T) {
+	broker := startBroker(t, 2)
+	expectRefused(t, gol.Params{Turns: 10, ImageWidth: 16, ImageHeight: 16, Engine: gol.HashLifeEngine, Broker: broker})
+	_, _, err := gol.BrokerParams(broker)
+	assert(t, err != nil, "the broker should not be running a simulation with another engine")
+}
+
+func testDistributedNoBroker(t *testing.T) {
+	l := listen(t)
+	address := l.Addr().String()
+	l.Close()
+
+	expectRefused(t, gol.Params{Turns: 10, ImageWidth: 16, ImageHeight: 16, Broker: address})
+}
+
+// runAttached attaches to the simulation on the broker, returning the turn it carried on from and the final state.
+func runAttached(p gol.Params) (int, int, []util.Cell) {
+	events := make(chan gol.Event, 1000)
+	go gol.Run(p, events, nil)
+	start, final := -1, -1
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.StateChange:
+			if e.NewState == gol.Executing && start < 0 {
+				start = e.CompletedTurns
+			}
+		case gol.FinalTurnComplete:
+			final, cells = e.CompletedTurns, e.Alive
+		}
+	}
+	return start, final, cells
+}
+
+func testDistributedDetach(t *testing.T) {
+	broker := startBroker(t, 2)
+	p := gol.Params{Turns: 200, ImageWidth: 16, ImageHeight: 16, Broker: broker}
+
+	// quitting detaches, leaving the broker to carry on by itself until the last turn
+	_, _, final := runKeys(t, p, "pnnnq")
+	assert(t, final == 3, "FinalTurnComplete should have a CompletedTurns of 3, not %v", final)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		saved, turn, err := gol.BrokerParams(broker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert(t, saved.ImageWidth == 16 && saved.ImageHeight == 16 && saved.Turns == 200,
+			"the broker should be running 200 turns of a 16x16 world, not %v of %vx%v", saved.Turns, saved.ImageWidth, saved.ImageHeight)
+		if turn == 200 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ERROR: the broker only reached turn %v by itself", turn)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a new controller attaches with more turns and carries on from where the broker stopped
+	start, final, cells := runAttached(gol.Params{Turns: 300, Broker: broker, Attach: true})
+	assert(t, start == 200, "the attached controller should carry on from turn 200, not %v", start)
+	assert(t, final == 300, "FinalTurnComplete should have a CompletedTurns of 300, not %v", final)
+	expected := runFinal(gol.Params{Turns: 300, Threads: 4, ImageWidth: 16, ImageHeight: 16})
+	assertEqualBoard(t, cells, expected, p)
+
+	// the attached controller stopped the simulation once it was complete
+	_, _, err := gol.BrokerParams(broker)
+	assert(t, err != nil, "the broker should have no simulation once the attached controller is finished")
+}
+
+func testDistributedAttachTopology(t *testing.T) {
+	broker := startBroker(t, 2)
+	p := gol.Params{Turns: 100, ImageWidth: 64, ImageHeight: 64, Topology: gol.KleinBottle, Engine: gol.PackedEngine, Broker: broker}
+	runKeys(t, p, "pnq")
+
+	// the attached controller is given neither the topology nor the engine,
+	// and stepping back has to restart the simulation on the broker with those it took from the broker
+	_, worlds, final := runKeys(t, gol.Params{Turns: 200, Broker: broker, Attach: true}, "pnnbbp")
+	assert(t, final == 200, "FinalTurnComplete should have a CompletedTurns of 200, not %v", final)
+	p.Turns, p.Broker, p.Threads = 200, "", 4
+	assertEqualBoard(t, worlds[len(worlds)-1], runFinal(p), p)
+}
+
+func testDistributedTakeover(t *testing.T) {
+	broker := startBroker(t, 2)
+	p := gol.Params{Turns: 100000000, ImageWidth: 16, ImageHeight: 16, Broker: broker}
+	events := make(chan gol.Event, 1000)
+	go gol.Run(p, events, nil)
+	for event := range events {
+		if _, ok := event.(gol.TurnComplete); ok {
+			break
+		}
+	}
+
+	// attaching takes over from the first controller, which then quits as if q was pressed
+	start, final, _ := runAttached(gol.Params{Broker: broker, Attach: true})
+	assert(t, start > 0 && final == start, "the attached controller should stop at the turn it attached at, not %v", final)
+	first := -1
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			first = e.CompletedTurns
+		}
+	}
+	assert(t, first > 0 && first <= start, "the first controller should quit at a turn before %v, not %v", start, first)
+}
+
+// buildWorker builds the worker command, returning its path.
+func buildWorker(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "worker")
+	if out, err := exec.Command("go", "build", "-o", path, "./worker").CombinedOutput(); err != nil {
+		t.Fatalf("ERROR: building the worker failed: %v\n%s", err, out)
+	}
+	return path
+}
+
+// startWorkerProcess runs the worker command built at the path on a free port with any other flags given,
+// returning the process, its address and the rest of its output. The process is killed at the end of the test.
+func startWorkerProcess(t *testing.T, path string, flags ...string) (*exec.Cmd, string, *bufio.Scanner) {
+	l := listen(t)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cmd := exec.Command(path, append([]string{"-port", fmt.Sprint(port)}, flags...)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	// the worker prints a line once it is listening
+	output := bufio.NewScanner(stdout)
+	if !output.Scan() {
+		t.Fatal("ERROR: the worker exited before listening")
+	}
+	return cmd, fmt.Sprintf("localhost:%v", port), output
+}
+
+// startWorkerProcesses runs the given number of worker commands and a broker that uses them,
+// returning the address of the broker along with the processes and addresses of the workers.
+func startWorkerProcesses(t *testing.T, n int) (string, []*exec.Cmd, []string) {
+	path := buildWorker(t)
+	var workers []*exec.Cmd
+	var addresses []string
+	for i := 0; i < n; i++ {
+		cmd, address, _ := startWorkerProcess(t, path)
+		workers, addresses = append(workers, cmd), append(addresses, address)
+	}
+	l := listen(t)
+	go gol.ServeBroker(l, addresses)
+	return l.Addr().String(), workers, addresses
+}
+
+// assertRecovered checks that the only worker to fail was the one at the address, and that the other two carried on
+// from the turn given to the end of the run.
+func assertRecovered(t *testing.T, recoveries []gol.WorkersRecovered, address string, turn int) {
+	if len(recoveries) != 1 {
+		t.Fatalf("ERROR: there should be one WorkersRecovered event, not %v", len(recoveries))
+	}
+	e := recoveries[0]
+	assert(t, len(e.Failed) == 1 && e.Failed[0] == address, "only %v should have failed, not %v", address, e.Failed)
+	assert(t, e.Workers == 2, "the broker should carry on with 2 workers, not %v", e.Workers)
+	assert(t, e.CompletedTurns == turn, "the broker should carry on from turn %v, not %v", turn, e.CompletedTurns)
+}
+
+func testDistributedWorkerFailure(t *testing.T) {
+	broker, workers, addresses := startWorkerProcesses(t, 3)
+
+	// the events are unbuffered so that the worker is dead before the next turn is processed
+	p := gol.Params{Turns: 2000, ImageWidth: 64, ImageHeight: 64, Broker: broker}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	killed, final := -1, -1
+	var recoveries []gol.WorkersRecovered
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if killed < 0 {
+				if err := workers[1].Process.Kill(); err != nil {
+					t.Fatal(err)
+				}
+				workers[1].Wait()
+				killed = e.CompletedTurns
+			}
+		case gol.WorkersRecovered:
+			recoveries = append(recoveries, e)
+		case gol.FinalTurnComplete:
+			final, cells = e.CompletedTurns, e.Alive
+		}
+	}
+
+	assertRecovered(t, recoveries, addresses[1], killed)
+	assert(t, final == p.Turns, "FinalTurnComplete should have a CompletedTurns of %v, not %v", p.Turns, final)
+	expected := runFinal(gol.Params{Turns: p.Turns, Threads: 4, ImageWidth: 64, ImageHeight: 64})
+	assertEqualBoard(t, cells, expected, p)
+}
+
+func testDistributedHungWorker(t *testing.T) {
+	broker, workers, addresses := startWorkerProcesses(t, 3)
+
+	// a stopped worker still accepts connections but never answers, so only it should be dropped and not the worker after it
+	p := gol.Params{Turns: 2000, ImageWidth: 64, ImageHeight: 64, Broker: broker}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	stopped, final := -1, -1
+	var recoveries []gol.WorkersRecovered
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if stopped < 0 {
+				if err := workers[1].Process.Signal(syscall.SIGSTOP); err != nil {
+					t.Fatal(err)
+				}
+				stopped = e.CompletedTurns
+			}
+		case gol.WorkersRecovered:
+			recoveries = append(recoveries, e)
+		case gol.FinalTurnComplete:
+			final, cells = e.CompletedTurns, e.Alive
+		}
+	}
+
+	assertRecovered(t, recoveries, addresses[1], stopped)
+	assert(t, final == p.Turns, "FinalTurnComplete should have a CompletedTurns of %v, not %v", p.Turns, final)
+	expected := runFinal(gol.Params{Turns: p.Turns, Threads: 4, ImageWidth: 64, ImageHeight: 64})
+	assertEqualBoard(t, cells, expected, p)
+}
+
+func testDistributedHeartbeat(t *testing.T) {
+	broker, workers, addresses := startWorkerProcesses(t, 3)
+
+	// a worker that hangs while the run is paused is dropped by the heartbeat, so the run carries on straight away
+	p := gol.Params{Turns: 2000, ImageWidth: 64, ImageHeight: 64, Broker: broker}
+	keyPresses := make(chan rune, 10)
+	events := make(chan gol.Event)
+	go gol.Run(p, events, keyPresses)
+	paused, final := -1, -1
+	var resumed time.Time
+	var recoveries []gol.WorkersRecovered
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if paused < 0 {
+				keyPresses <- 'p'
+				paused = 0
+			}
+		case gol.StateChange:
+			if e.NewState == gol.Paused {
+				paused = e.CompletedTurns
+				if err := workers[1].Process.Signal(syscall.SIGSTOP); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(3 * time.Second)
+				resumed = time.Now()
+				keyPresses <- 'p'
+			}
+		case gol.WorkersRecovered:
+			recoveries = append(recoveries, e)
+			waited := time.Since(resumed)
+			assert(t, waited < 2*time.Second, "the run should carry on as soon as it is resumed, not after %v", waited)
+		case gol.FinalTurnComplete:
+			final, cells = e.CompletedTurns, e.Alive
+		}
+	}
+
+	assertRecovered(t, recoveries, addresses[1], paused)
+	assert(t, final == p.Turns, "FinalTurnComplete should have a CompletedTurns of %v, not %v", p.Turns, final)
+	expected := runFinal(gol.Params{Turns: p.Turns, Threads: 4, ImageWidth: 64, ImageHeight: 64})
+	assertEqualBoard(t, cells, expected, p)
+}
+
+func testDistributedRegistration(t *testing.T) {
+	path := buildWorker(t)
+	first, address, _ := startWorkerProcess(t, path)
+	l := listen(t)
+	broker := l.Addr().String()
+	go gol.ServeBroker(l, []string{address})
+
+	// the events are unbuffered so that every change to the workers happens between turns
+	p := gol.Params{Turns: 3000, ImageWidth: 64, ImageHeight: 64, Broker: broker}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	changes, final := 0, -1
+	var cells []util.Cell
+	var joined []*exec.Cmd
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			switch changes {
+			case 0:
+				// two workers join by themselves
+				for i := 0; i < 2; i++ {
+					cmd, _, output := startWorkerProcess(t, path, "-broker", broker)
+					if !output.Scan() {
+						t.Fatal("ERROR: the worker exited before registering")
+					}
+					joined = append(joined, cmd)
+				}
+			case 1:
+				// the first worker leaves, so killing it afterwards should make no difference
+				if err := gol.DeregisterWorker(broker, address); err != nil {
+					t.Fatal(err)
+				}
+				first.Process.Kill()
+				first.Wait()
+			case 2:
+				// interrupting a worker that joined by itself makes it leave before exiting
+				joined[0].Process.Signal(os.Interrupt)
+				if err := joined[0].Wait(); err != nil {
+					t.Errorf("ERROR: the worker failed to leave: %v", err)
+				}
+			}
+			changes++
+		case gol.WorkersRecovered:
+			t.Errorf("ERROR: no workers should fail, not %v", e.Failed)
+		case gol.FinalTurnComplete:
+			final, cells = e.CompletedTurns, e.Alive
+		}
+	}
+
+	assert(t, changes > 3, "the run should carry on after the workers change, not stop after %v turns", changes)
+	assert(t, final == p.Turns, "FinalTurnComplete should have a CompletedTurns of %v, not %v", p.Turns, final)
+	expected := runFinal(gol.Params{Turns: p.Turns, Threads: 4, ImageWidth: 64, ImageHeight: 64})
+	assertEqualBoard(t, cells, expected, p)
+
+	// a worker can only leave once, but the last one can leave once the run is over
+	assert(t, gol.DeregisterWorker(broker, address) != nil, "the first worker should not be able to leave twice")
+	joined[1].Process.Signal(os.Interrupt)
+	if err := joined[1].Wait(); err != nil {
+		t.Errorf("ERROR: the last worker failed to leave: %v", err)
+	}
+}
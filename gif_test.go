@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestGif tests recording every RecordEvery turns as an animated gif.
+func TestGif(t *testing.T) {
+	t.Run("Delay", testGifDelay)
+	t.Run("Concurrent", testGifConcurrent)
+	for _, engine := range []gol.Engine{gol.ByteEngine, gol.HashLifeEngine} {
+		t.Run(engine.String(), func(t *testing.T) {
+			emptyOutFolder()
+			p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16, Engine: engine,
+				RecordEvery: 10, RecordScale: 3, RecordDelay: 50 * time.Millisecond}
+			runFinal(p)
+
+			file, err := os.Open("out/16x16x100.gif")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			recording, err := gif.DecodeAll(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// turns 0, 10, ..., 100
+			if len(recording.Image) != 11 {
+				t.Fatalf("ERROR: Expected 11 frames, got %v", len(recording.Image))
+			}
+			for i, frame := range recording.Image {
+				bounds := frame.Bounds()
+				assert(t, bounds.Dx() == 48 && bounds.Dy() == 48, "frame %v should be 48x48, not %vx%v", i, bounds.Dx(), bounds.Dy())
+				assert(t, recording.Delay[i] == 5, "frame %v should be shown for 5 hundredths of a second, not %v", i, recording.Delay[i])
+			}
+
+			for frame, path := range map[int]string{0: "images/16x16.pgm", 10: "check/images/16x16x100.pgm"} {
+				var alive []util.Cell
+				for y := 0; y < 16; y++ {
+					for x := 0; x < 16; x++ {
+						r, _, _, _ := recording.Image[frame].At(x*3+1, y*3+1).RGBA()
+						if r != 0 {
+							alive = append(alive, util.Cell{X: x, Y: y})
+						}
+					}
+				}
+				assertEqualBoard(t, alive, readAliveCells(path, 16, 16), p)
+			}
+		})
+	}
+}
+
+func testGifDelay(t *testing.T) {
+	// delays are rounded to the nearest hundredth of a second, but frames are always shown for at least one
+	for delay, expected := range map[time.Duration]int{5 * time.Millisecond: 1, 19 * time.Millisecond: 2, 0: 10, 1234 * time.Millisecond: 123} {
+		t.Run(delay.String(), func(t *testing.T) {
+			emptyOutFolder()
+			runFinal(gol.Params{Turns: 2, Threads: 1, ImageWidth: 16, ImageHeight: 16, RecordEvery: 1, RecordDelay: delay})
+			file, err := os.Open("out/16x16x2.gif")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			recording, err := gif.DecodeAll(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert(t, fmt.Sprint(recording.Delay) == fmt.Sprint([]int{expected, expected, expected}),
+				"the 3 frames should each be shown for %v hundredths of a second, not %v", expected, recording.Delay)
+			temporary, _ := filepath.Glob("out/16x16.gif.*")
+			assert(t, len(temporary) == 0, "the temporary file of the recording should be gone, not %v", temporary)
+		})
+	}
+}
+
+func testGifConcurrent(t *testing.T) {
+	// two runs of the same size record to different temporary files
+	emptyOutFolder()
+	var wg sync.WaitGroup
+	for _, turns := range []int{50, 60} {
+		wg.Add(1)
+		go func(turns int) {
+			defer wg.Done()
+			runFinal(gol.Params{Turns: turns, Threads: 2, ImageWidth: 16, ImageHeight: 16, RecordEvery: 1})
+		}(turns)
+	}
+	wg.Wait()
+	for _, turns := range []int{50, 60} {
+		file, err := os.Open(fmt.Sprintf("out/16x16x%v.gif", turns))
+		if err != nil {
+			t.Fatal(err)
+		}
+		recording, err := gif.DecodeAll(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert(t, len(recording.Image) == turns+1, "the recording of %v turns should have %v frames, not %v", turns, turns+1, len(recording.Image))
+	}
+}
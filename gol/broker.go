@@ -0,0 +1,585 @@
+package gol
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// advanceBudget is roughly how long the broker spends on a single Advance before replying,
+// so that the controller still gets to handle key presses and report alive cells while the run is fast.
+const advanceBudget = 20 * time.Millisecond
+
+// syncInterval is how often the broker collects the changes from the workers while processing turns by itself,
+// which limits how many turns are lost when a worker fails.
+const syncInterval = time.Second
+
+// Broker divides the world uploaded by a controller between the remote workers and tells them when to process each turn.
+// It runs a single simulation at a time. While no controller is attached it processes the turns by itself
+// until the last one, and it carries on serving new controllers once the simulation is stopped.
+//
+// The broker keeps the world as it was at the last turn that the changes were collected from the workers.
+// If a worker fails, the broker drops it and loads that world onto the rest, which carry on from that turn.
+type Broker struct {
+	mu        sync.Mutex
+	addresses []string
+	workers   []*rpc.Client
+	// generation counts the times the world has been loaded onto the workers
+	generation int
+	// pool is nil unless a simulation has been started
+	pool *remotePool
+	// recoveries are those since the attached controller last advanced
+	recoveries []Recovery
+	// session is that of the last controller to start or attach to the simulation
+	session  int
+	attached bool
+	// running is whether the broker is processing turns by itself
+	running bool
+}
+
+// ServeBroker connects to the remote workers at the given addresses and then serves controllers on the listener
+// until it is closed. The workers connect to each other at the same addresses, so they must be reachable from every worker.
+// More workers can register with the broker while it is running, see RegisterWorker.
+// Workers that fail are dropped for good, and the broker carries on with the rest. A worker is found to have failed
+// either when a call to it fails or takes longer than workerTimeout during a turn, or when it misses a heartbeat between turns.
+func ServeBroker(l net.Listener, workers []string) error {
+	b := &Broker{addresses: append([]string(nil), workers...)}
+	for _, address := range workers {
+		client, err := rpc.Dial("tcp", address)
+		if err != nil {
+			b.close()
+			return fmt.Errorf("worker %v: %v", address, err)
+		}
+		b.workers = append(b.workers, client)
+	}
+	defer b.close()
+	done := make(chan struct{})
+	defer close(done)
+	go b.heartbeat(done)
+
+	server := rpc.NewServer()
+	if err := server.Register(b); err != nil {
+		return err
+	}
+	server.Accept(l)
+	return nil
+}
+
+// close disconnects from every worker, including any that registered while the broker was running.
+func (b *Broker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, client := range b.workers {
+		client.Close()
+	}
+}
+
+// heartbeat pings the workers every heartbeatInterval until done is closed, dropping any that have failed.
+// A worker that fails between turns, such as while the controller is paused, is then replaced before the next turn
+// rather than holding it up for workerTimeout.
+func (b *Broker) heartbeat(done <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		b.mu.Lock()
+		if failed := b.dropFailedWorkers(); len(failed) > 0 && b.pool != nil {
+			if err := b.reload(failed); err != nil {
+				fmt.Println("The simulation failed:", err)
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// checkSession returns an error unless there is a simulation and the session is that of the attached controller.
+// The broker must be locked.
+func (b *Broker) checkSession(session int) error {
+	switch {
+	case b.pool == nil:
+		return fmt.Errorf("no simulation has been started")
+	case session != b.session:
+		return fmt.Errorf("another controller has attached to the simulation")
+	case !b.attached:
+		return fmt.Errorf("the controller has detached from the simulation")
+	}
+	return nil
+}
+
+// Start receives the world from a controller. It fails if there is already a simulation, even a detached one,
+// which has to be attached to and stopped first.
+func (b *Broker) Start(req StartRequest, res *StartResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pool != nil {
+		return fmt.Errorf("the broker is already running a simulation")
+	}
+	if len(req.World) == 0 || len(req.World[0]) == 0 {
+		return fmt.Errorf("the world is empty")
+	}
+	for _, row := range req.World {
+		if len(row) != len(req.World[0]) {
+			return fmt.Errorf("the rows of the world are not all the same length")
+		}
+	}
+	// the remote workers only have strips, so a whole quadtree is out of the question
+	if req.Engine == HashLifeEngine {
+		return fmt.Errorf("the remote workers can not use the %v engine", req.Engine)
+	}
+	pool, _, err := b.load(req)
+	if err != nil {
+		return err
+	}
+	b.pool = pool
+	b.recoveries = nil
+	b.session++
+	b.attached = true
+	res.Session = b.session
+	res.Workers = len(b.pool.workers)
+	return nil
+}
+
+// Attach takes over the simulation from any other controller, stopping the broker from processing turns by itself.
+func (b *Broker) Attach(req AttachRequest, res *AttachResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pool == nil {
+		return fmt.Errorf("the broker has no simulation to attach to")
+	}
+	world, err := b.pool.world()
+	if err != nil {
+		if err := b.recover(err); err != nil {
+			return err
+		}
+		world = copyWorld(b.pool.current)
+	}
+	if req.Turns != 0 {
+		b.pool.params.Turns = req.Turns
+	}
+	b.session++
+	b.attached = true
+	*res = AttachResponse{Session: b.session, World: world, Turn: b.pool.turn, Turns: b.pool.params.Turns,
+		Rule: b.pool.params.Rule, Topology: b.pool.params.Topology, Engine: b.pool.params.Engine}
+	return nil
+}
+
+// Status describes the simulation without attaching to it.
+func (b *Broker) Status(req StatusRequest, res *StatusResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pool == nil {
+		return fmt.Errorf("the broker has no simulation")
+	}
+	*res = StatusResponse{Width: b.pool.width, Height: b.pool.height,
+		Turn: b.pool.turn, Turns: b.pool.params.Turns,
+		Rule: b.pool.params.Rule, Topology: b.pool.params.Topology, Engine: b.pool.params.Engine, Attached: b.attached}
+	return nil
+}
+
+// Advance processes turns until either the number requested are complete or advanceBudget has passed,
+// always processing at least one. If a worker fails the turns are processed again by the rest of the workers,
+// from the world the controller already has.
+func (b *Broker) Advance(req AdvanceRequest, res *AdvanceResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.checkSession(req.Session); err != nil {
+		return err
+	}
+	for {
+		turns, flipped, err := b.pool.advance(req.Turns)
+		if err == nil {
+			*res = AdvanceResponse{Turns: turns, Flipped: flipped, Alive: b.pool.alive, Recoveries: b.recoveries}
+			b.recoveries = nil
+			return nil
+		}
+		if err := b.recover(err); err != nil {
+			return err
+		}
+	}
+}
+
+// Detach leaves the broker to process the turns by itself until a controller attaches again.
+func (b *Broker) Detach(req DetachRequest, res *DetachResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.checkSession(req.Session); err != nil {
+		return err
+	}
+	b.attached = false
+	if !b.running {
+		b.running = true
+		go b.run()
+	}
+	return nil
+}
+
+// Stop ends the simulation so that another can be started. The workers drop their strips straight away.
+func (b *Broker) Stop(req StopRequest, res *StopResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.checkSession(req.Session); err != nil {
+		return err
+	}
+	// a worker that can not be reached has failed, and is dropped by the next heartbeat
+	if err := b.pool.unload(); err != nil {
+		fmt.Println("Failed to unload the workers:", err)
+	}
+	b.pool = nil
+	b.attached = false
+	return nil
+}
+
+// Register adds a worker. Any simulation is divided between all of the workers again before its next turn.
+func (b *Broker) Register(req RegisterRequest, res *RegisterResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, address := range b.addresses {
+		if address == req.Address {
+			return fmt.Errorf("worker %v is already registered", req.Address)
+		}
+	}
+	client, err := rpc.Dial("tcp", req.Address)
+	if err != nil {
+		return err
+	}
+	b.addresses, b.workers = append(b.addresses, req.Address), append(b.workers, client)
+	fmt.Println("Worker", req.Address, "registered")
+	// the worker is still registered if the simulation can not carry on
+	if err := b.repartition(); err != nil {
+		fmt.Println("The simulation failed:", err)
+	}
+	res.Workers = len(b.workers)
+	return nil
+}
+
+// Deregister removes a worker once any simulation has been divided between the rest of the workers,
+// so the worker can shut down as soon as the call returns.
+func (b *Broker) Deregister(req DeregisterRequest, res *DeregisterResponse) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := 0
+	for i < len(b.addresses) && b.addresses[i] != req.Address {
+		i++
+	}
+	switch {
+	case i == len(b.addresses):
+		return fmt.Errorf("worker %v is not registered", req.Address)
+	case len(b.workers) == 1 && b.pool != nil:
+		return fmt.Errorf("the last worker can not leave while a simulation is running")
+	}
+	client := b.workers[i]
+	b.addresses = append(b.addresses[:i:i], b.addresses[i+1:]...)
+	b.workers = append(b.workers[:i:i], b.workers[i+1:]...)
+	// the pool still has the worker, so the changes can be collected from its strip before it is closed
+	err := b.repartition()
+	client.Close()
+	fmt.Println("Worker", req.Address, "deregistered")
+	if err != nil {
+		fmt.Println("The simulation failed:", err)
+	}
+	return nil
+}
+
+// run processes turns one at a time while no controller is attached, until the last turn is complete.
+// The broker is unlocked between turns so that a controller can attach at any time.
+func (b *Broker) run() {
+	synced := time.Now()
+	for {
+		b.mu.Lock()
+		if b.attached || b.pool == nil || b.pool.turn >= b.pool.params.Turns {
+			b.running = false
+			b.mu.Unlock()
+			return
+		}
+		err := b.pool.step()
+		if err == nil && (time.Since(synced) > syncInterval || b.pool.turn == b.pool.params.Turns) {
+			_, err = b.pool.changes()
+			synced = time.Now()
+		}
+		if err != nil {
+			if err := b.recover(err); err != nil {
+				fmt.Println("Stopped processing turns by itself:", err)
+				b.running = false
+				b.mu.Unlock()
+				return
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// load loads the world onto the workers, dropping any that have failed and trying again with the rest.
+// It returns the addresses of the workers that were dropped. The broker must be locked.
+func (b *Broker) load(req StartRequest) (*remotePool, []string, error) {
+	var failed []string
+	for {
+		if len(b.workers) == 0 {
+			return nil, failed, fmt.Errorf("the broker has no workers")
+		}
+		b.generation++
+		pool, err := newRemotePool(req, b.generation, b.addresses, b.workers)
+		if err == nil {
+			return pool, failed, nil
+		}
+		dropped := b.dropFailedWorkers()
+		if len(dropped) == 0 {
+			return nil, failed, err
+		}
+		failed = append(failed, dropped...)
+	}
+}
+
+// recover is called once a call to the workers has failed with the given error. If any of the workers have
+// failed it drops them and loads the world at the last turn that the changes were collected onto the rest.
+// Otherwise, or if there are no workers left, it returns an error and the simulation can not carry on.
+// The broker must be locked.
+func (b *Broker) recover(cause error) error {
+	failed := b.dropFailedWorkers()
+	if len(failed) == 0 {
+		return cause
+	}
+	return b.reload(failed)
+}
+
+// repartition divides the simulation, if there is one, between the workers the broker has now.
+// It carries on from the turn the simulation has reached. The broker must be locked.
+func (b *Broker) repartition() error {
+	if b.pool == nil {
+		return nil
+	}
+	if _, err := b.pool.changes(); err != nil {
+		return b.recover(err)
+	}
+	return b.reload(nil)
+}
+
+// reload loads the world at the last turn that the changes were collected onto the workers, reporting a recovery
+// if any workers have failed. If the world can not be loaded the simulation is stopped. The broker must be locked.
+func (b *Broker) reload(failed []string) error {
+	req := b.pool.params
+	req.World, req.Turn = b.pool.current, b.pool.synced
+	pool, more, err := b.load(req)
+	if err != nil {
+		b.pool = nil
+		b.attached = false
+		return err
+	}
+	b.pool = pool
+	failed = append(failed, more...)
+	fmt.Printf("Carrying on from turn %v with %v workers\n", req.Turn, len(pool.workers))
+	if len(failed) > 0 {
+		b.recoveries = append(b.recoveries, Recovery{Turn: req.Turn, Failed: failed, Workers: len(pool.workers)})
+	}
+	return nil
+}
+
+// dropFailedWorkers pings every worker and drops those that do not answer within pingTimeout,
+// returning their addresses. The broker must be locked.
+func (b *Broker) dropFailedWorkers() []string {
+	calls := make([]*rpc.Call, len(b.workers))
+	for i, client := range b.workers {
+		calls[i] = client.Go(workerPingRPC, PingRequest{}, &PingResponse{}, nil)
+	}
+	timeout := time.NewTimer(pingTimeout)
+	defer timeout.Stop()
+	var failed, addresses []string
+	var workers []*rpc.Client
+	expired := false
+	for i, call := range calls {
+		answered := false
+		if !expired {
+			select {
+			case <-call.Done:
+				answered = call.Error == nil
+			case <-timeout.C:
+				expired = true
+			}
+		}
+		// once the timeout has passed the rest of the workers have had as long to answer, so they are only checked
+		if expired {
+			select {
+			case <-call.Done:
+				answered = call.Error == nil
+			default:
+			}
+		}
+		if answered {
+			addresses, workers = append(addresses, b.addresses[i]), append(workers, b.workers[i])
+			continue
+		}
+		fmt.Println("Worker", b.addresses[i], "has failed")
+		b.workers[i].Close()
+		failed = append(failed, b.addresses[i])
+	}
+	b.addresses, b.workers = addresses, workers
+	return failed
+}
+
+// remotePool divides the world into a strip for each remote worker, which keeps it for the whole run.
+// Every turn the pool tells all of the workers to step and waits for them all to finish before the next,
+// so the rows they exchange with each other are always from the same turn.
+type remotePool struct {
+	params        StartRequest
+	workers       []*rpc.Client
+	width, height int
+	turn          int
+	alive         int
+	// current is the world at turn synced, when the changes were last collected from the workers
+	current [][]uint8
+	synced  int
+	// first and last are the first and last columns of the world, only gathered for the cross-surface topology
+	first, last []uint8
+}
+
+// newRemotePool loads a strip of the world onto each worker, telling it the addresses of its neighbours.
+func newRemotePool(req StartRequest, generation int, addresses []string, workers []*rpc.Client) (*remotePool, error) {
+	world := req.World
+	// every worker needs at least one row
+	if len(workers) > len(world) {
+		workers = workers[:len(world)]
+	}
+	pool := &remotePool{workers: workers, width: len(world[0]), height: len(world), turn: req.Turn,
+		alive: len(calculateAliveCells(Params{}, world)), current: copyWorld(world), synced: req.Turn}
+	// the world is only kept by the workers
+	pool.params, pool.params.World = req, nil
+	if req.Topology == CrossSurface {
+		pool.first, pool.last = make([]uint8, pool.height), make([]uint8, pool.height)
+		for y, row := range world {
+			pool.first[y], pool.last[y] = row[0]/255, row[pool.width-1]/255
+		}
+	}
+
+	strips := len(workers)
+	calls := make([]*rpc.Call, strips)
+	for i, client := range workers {
+		y1, y2 := stripRows(pool.height, strips, i)
+		req := LoadRequest{Generation: generation, Rows: world[y1 : y2+1], Y1: y1, Width: pool.width, Height: pool.height,
+			Rule: req.Rule, Topology: req.Topology, Engine: req.Engine,
+			Above: addresses[(i-1+strips)%strips], Below: addresses[(i+1)%strips]}
+		calls[i] = client.Go(workerLoadRPC, req, &LoadResponse{}, nil)
+	}
+	if err := waitForWorkers(calls); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// waitForWorkers waits for a call to every worker to finish, returning the first error.
+// It gives up once workerTimeout has passed.
+func waitForWorkers(calls []*rpc.Call) error {
+	timeout := time.NewTimer(workerTimeout)
+	defer timeout.Stop()
+	var err error
+	for i, call := range calls {
+		select {
+		case <-call.Done:
+			if call.Error != nil && err == nil {
+				err = fmt.Errorf("worker %v: %v", i, call.Error)
+			}
+		case <-timeout.C:
+			return fmt.Errorf("worker %v did not respond within %v", i, workerTimeout)
+		}
+	}
+	return err
+}
+
+// advance processes turns until either the number given are complete or advanceBudget has passed,
+// always processing at least one, and returns the cells that changed over all of them.
+func (pool *remotePool) advance(turns int) (int, []util.Cell, error) {
+	start := time.Now()
+	processed := 0
+	for processed < turns && (processed == 0 || time.Since(start) < advanceBudget) {
+		if err := pool.step(); err != nil {
+			return 0, nil, err
+		}
+		processed++
+	}
+	flipped, err := pool.changes()
+	if err != nil {
+		return 0, nil, err
+	}
+	return processed, flipped, nil
+}
+
+// step processes a single turn on every strip.
+func (pool *remotePool) step() error {
+	calls := make([]*rpc.Call, len(pool.workers))
+	for i, client := range pool.workers {
+		calls[i] = client.Go(workerStepRPC, StepRequest{First: pool.first, Last: pool.last}, &StepResponse{}, nil)
+	}
+	if err := waitForWorkers(calls); err != nil {
+		return err
+	}
+
+	alive := 0
+	for i, call := range calls {
+		res := call.Reply.(*StepResponse)
+		alive += res.Alive
+		if pool.first != nil {
+			y1, _ := stripRows(pool.height, len(pool.workers), i)
+			copy(pool.first[y1:], res.First)
+			copy(pool.last[y1:], res.Last)
+		}
+	}
+	pool.alive = alive
+	pool.turn++
+	return nil
+}
+
+// changes returns the cells that have changed since the world was last collected or the changes were last asked for,
+// and applies them to the world kept by the pool.
+func (pool *remotePool) changes() ([]util.Cell, error) {
+	calls := make([]*rpc.Call, len(pool.workers))
+	for i, client := range pool.workers {
+		calls[i] = client.Go(workerChangesRPC, ChangesRequest{}, &ChangesResponse{}, nil)
+	}
+	if err := waitForWorkers(calls); err != nil {
+		return nil, err
+	}
+	var flipped []util.Cell
+	for _, call := range calls {
+		flipped = append(flipped, call.Reply.(*ChangesResponse).Flipped...)
+	}
+	for _, cell := range flipped {
+		pool.current[cell.Y][cell.X] ^= 255
+	}
+	pool.synced = pool.turn
+	return flipped, nil
+}
+
+// unload tells every worker to drop its strip.
+func (pool *remotePool) unload() error {
+	calls := make([]*rpc.Call, len(pool.workers))
+	for i, client := range pool.workers {
+		calls[i] = client.Go(workerUnloadRPC, UnloadRequest{}, &UnloadResponse{}, nil)
+	}
+	return waitForWorkers(calls)
+}
+
+// world collects the strips of every worker.
+func (pool *remotePool) world() ([][]uint8, error) {
+	calls := make([]*rpc.Call, len(pool.workers))
+	for i, client := range pool.workers {
+		calls[i] = client.Go(workerRowsRPC, RowsRequest{}, &RowsResponse{}, nil)
+	}
+	if err := waitForWorkers(calls); err != nil {
+		return nil, err
+	}
+	world := make([][]uint8, 0, pool.height)
+	for _, call := range calls {
+		world = append(world, call.Reply.(*RowsResponse).Rows...)
+	}
+	if len(world) != pool.height {
+		return nil, fmt.Errorf("the workers sent %v rows instead of %v", len(world), pool.height)
+	}
+	pool.current, pool.synced = copyWorld(world), pool.turn
+	return world, nil
+}
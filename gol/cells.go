@@ -0,0 +1,63 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// decodeCells reads a pattern in the plaintext format, where each line is a row of cells, e.g.
+//
+//	!Name: Glider
+//	.O.
+//	..O
+//	OOO
+//
+// Rows may leave out the dead cells at their end, so the width is that of the longest row.
+func decodeCells(r io.Reader, sizeOnly bool) (*pattern, error) {
+	scanner := bufio.NewScanner(r)
+	p := &pattern{sizeOnly: sizeOnly}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+		for x, c := range line {
+			switch c {
+			case 'O', '*':
+				p.add(util.Cell{X: x, Y: p.height})
+			case '.':
+			default:
+				return nil, fmt.Errorf("unexpected %q in row %v of the pattern", c, p.height+1)
+			}
+		}
+		if len(line) > p.width {
+			p.width = len(line)
+		}
+		p.height++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// encodeCells writes the world in the plaintext format. Every row is written in full so the size of the world is kept.
+func encodeCells(w io.Writer, world [][]uint8, name string) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "!Name: %v\n", name)
+	for _, row := range world {
+		for _, cell := range row {
+			if cell == 255 {
+				out.WriteByte('O')
+			} else {
+				out.WriteByte('.')
+			}
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
@@ -0,0 +1,160 @@
+package gol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// checkpointPrefix starts the comment line that holds the progress of the run in a checkpoint file.
+const checkpointPrefix = "#C gol checkpoint:"
+
+// encodeCheckpoint writes the world along with the turn and the params needed to carry on from it.
+// A checkpoint is a run length encoded pattern with one extra comment line, so other tools can open it too, e.g.
+//
+//	#C gol checkpoint: turn = 5, turns = 100, threads = 8, engine = bytes, topology = torus
+//	x = 3, y = 3, rule = B3/S23
+//	bob$2bo$3o!
+func encodeCheckpoint(w io.Writer, world [][]uint8, p Params, turn int) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "%v turn = %v, turns = %v, threads = %v, engine = %v, topology = %v\n",
+		checkpointPrefix, turn, p.Turns, p.Threads, p.Engine, p.Topology)
+	if err := encodeRle(out, world, p.Rule); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// decodeCheckpoint reads a checkpoint, returning the world as a pattern along with the saved params and turn.
+func decodeCheckpoint(r io.Reader) (*pattern, Params, int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, Params{}, 0, err
+	}
+	var line string
+	for _, l := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(l, checkpointPrefix) {
+			line = strings.TrimSpace(strings.TrimPrefix(l, checkpointPrefix))
+			break
+		}
+	}
+	if line == "" {
+		return nil, Params{}, 0, fmt.Errorf("missing the %v line", checkpointPrefix)
+	}
+
+	var p Params
+	turn := -1
+	for _, field := range strings.Split(line, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, Params{}, 0, fmt.Errorf("invalid checkpoint field %q", strings.TrimSpace(field))
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case "turn":
+			turn, err = strconv.Atoi(value)
+		case "turns":
+			p.Turns, err = strconv.Atoi(value)
+		case "threads":
+			p.Threads, err = strconv.Atoi(value)
+		case "engine":
+			err = p.Engine.Set(value)
+		case "topology":
+			err = p.Topology.Set(value)
+		}
+		if err != nil {
+			return nil, Params{}, 0, fmt.Errorf("invalid checkpoint field %q: %v", strings.TrimSpace(field), err)
+		}
+	}
+	if turn < 0 {
+		return nil, Params{}, 0, fmt.Errorf("the checkpoint should give a turn that is not negative")
+	}
+
+	pat, err := decodeRle(bytes.NewReader(data), false)
+	if err != nil {
+		return nil, Params{}, 0, err
+	}
+	// the pattern is the whole world, so it is never moved
+	pat.anchored = true
+	p.ImageWidth, p.ImageHeight, p.Rule = pat.width, pat.height, pat.rule
+	return pat, p, turn, nil
+}
+
+// CheckpointParams reads the params saved in a checkpoint file, including its size and rule, and the turn it was saved at.
+func CheckpointParams(path string) (Params, int, error) {
+	file, _, err := openInput(path)
+	if err != nil {
+		return Params{}, 0, err
+	}
+	defer file.Close()
+	_, p, turn, err := decodeCheckpoint(file)
+	if err != nil {
+		return Params{}, 0, fmt.Errorf("%v: %v", path, err)
+	}
+	return p, turn, nil
+}
+
+// checkpointPath returns where checkpoints of a world of the size in p are written, compressed if p says so.
+func checkpointPath(p Params) string {
+	return fmt.Sprintf("out/%vx%v.checkpoint%v", p.ImageWidth, p.ImageHeight, compressedExtension(p))
+}
+
+// writeCheckpoint receives the turn and the world from the distributor and saves them.
+// The checkpoint is written to a temporary file first, so an earlier one is never lost if the process dies part way through.
+func (io *ioState) writeCheckpoint() {
+	_ = os.Mkdir("out", os.ModePerm)
+
+	turn := <-io.channels.turn
+	world := make([][]byte, io.params.ImageHeight)
+	for y := range world {
+		world[y] = make([]byte, io.params.ImageWidth)
+		for x := range world[y] {
+			world[y][x] = <-io.channels.output
+		}
+	}
+
+	path := checkpointPath(io.params)
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err == nil {
+		out, finish := compressOutput(file, io.params.Compress)
+		err = encodeCheckpoint(out, world, io.params, turn)
+		if finishErr := finish(); err == nil {
+			err = finishErr
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(file.Name(), path)
+		}
+	}
+	if err != nil {
+		fmt.Println("Failed to write the checkpoint:", err)
+		return
+	}
+	fmt.Println("Checkpoint", path, "at turn", turn, "done!")
+}
+
+// resume reads the world and turn saved in a checkpoint file.
+func (io *ioState) resume(path string) ([]uint8, int, error) {
+	file, _, err := openInput(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	p, _, turn, err := decodeCheckpoint(file)
+	var image []uint8
+	if err == nil {
+		image, err = io.place(p)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%v: %v", path, err)
+	}
+	return image, turn, nil
+}
@@ -0,0 +1,65 @@
+package gol
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gzipExtension marks files that are compressed with gzip. It goes after the extension of the format,
+// as in 512x512x100.pgm.gz, so the format can still be chosen from the rest of the name.
+// gzip is the only compression supported, as the standard library has no zstd.
+const gzipExtension = ".gz"
+
+// compressedInput is a file being read through gzip. Closing it closes both.
+type compressedInput struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (c *compressedInput) Close() error {
+	err := c.Reader.Close()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// openInput opens a file for reading, decompressing it if its name ends in .gz.
+// It also returns the extension of the format inside, such as .rle for glider.rle.gz.
+func openInput(path string) (io.ReadCloser, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	name := strings.ToLower(path)
+	if !strings.HasSuffix(name, gzipExtension) {
+		return file, filepath.Ext(name), nil
+	}
+	stream, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, "", err
+	}
+	return &compressedInput{Reader: stream, file: file}, filepath.Ext(strings.TrimSuffix(name, gzipExtension)), nil
+}
+
+// compressOutput returns a writer that compresses into the file if compress is set.
+// finish must be called once everything has been written, before the file is synced or closed.
+func compressOutput(file *os.File, compress bool) (w io.Writer, finish func() error) {
+	if !compress {
+		return file, func() error { return nil }
+	}
+	stream := gzip.NewWriter(file)
+	return stream, stream.Close
+}
+
+// compressedExtension returns the extension added to files written with the params, if any.
+func compressedExtension(p Params) string {
+	if p.Compress {
+		return gzipExtension
+	}
+	return ""
+}
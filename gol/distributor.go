@@ -2,6 +2,7 @@ package gol
 
 import (
 	"fmt"
+	"time"
 
 	"uk.ac.bris.cs/gameoflife/util"
 )
@@ -11,15 +12,55 @@ type distributorChannels struct {
 	ioCommand  chan<- ioCommand
 	ioIdle     <-chan bool
 	ioFilename chan<- string
+	ioTurn     chan<- int
+	ioAges     chan<- [][]int
 	ioOutput   chan<- uint8
 	ioInput    <-chan uint8
+	ioHeader   <-chan imageHeader
+	keyPresses <-chan rune
 }
 
-// closure to return return immutable cell to avoid overwriting
-func makeImmutableWorld(world [][]uint8) func(y, x int) uint8 {
-	return func(y, x int) uint8 {
-		return world[y][x]
+// simulation owns the world while the turns are being processed.
+type simulation interface {
+	// advance processes at least one turn but no more than the given number of turns, returning how many
+	// were processed, the cells that changed state and the number of alive cells afterwards.
+	advance(turns int) (int, []util.Cell, int)
+	// world returns a copy of the current world.
+	world() [][]uint8
+	// stop shuts down any goroutines used by the simulation.
+	stop()
+	// err returns why the simulation can not carry on, in which case advance processes no turns.
+	// Only remote simulations ever fail.
+	err() error
+}
+
+// detacher is implemented by simulations that can carry on by themselves once the run is over.
+type detacher interface {
+	// detach is used in place of stop when q is pressed.
+	detach()
+}
+
+// recoverer is implemented by simulations that can carry on after some of their workers fail.
+type recoverer interface {
+	// recovered returns an event for every recovery since it was last called.
+	recovered() []WorkersRecovered
+}
+
+// newSimulation chooses how to process the turns based on the broker and engine in p.
+// The turn of the world is only needed by a broker, and session is only set if the world was received
+// from the broker when attaching to it.
+func newSimulation(p Params, world [][]uint8, turn, session int) (simulation, error) {
+	if p.Broker != "" {
+		return newRemoteSimulation(p, world, turn, session)
+	}
+	if p.Engine == HashLifeEngine {
+		if !canHashLife(p) {
+			return nil, fmt.Errorf("the hashlife engine needs a square torus with a power of two size, not a %vx%v world with the %v topology",
+				p.ImageWidth, p.ImageHeight, p.Topology)
+		}
+		return newHashLife(p, world), nil
 	}
+	return newWorkerPool(p, world), nil
 }
 
 // standard calculate alive cells function from labs
@@ -35,115 +76,311 @@ func calculateAliveCells(p Params, world [][]byte) []util.Cell {
 	return aliveCells
 }
 
-func calculateNextState(p Params, c distributorChannels, world [][]uint8, turn int, res chan<- [][]uint8) {
-
-	// new empty 2d world
-	newWorld := make([][]byte, 0)
-
-	// makes channel for each worker
-	resChans := make([]chan [][]uint8, p.Threads)
-	for i := range resChans {
-		resChans[i] = make(chan [][]uint8)
+// writeImage sends the world to the io goroutine to be written, without waiting for the file to be complete.
+// The io goroutine sends ImageOutputComplete itself once it is. ages is only sent if it is needed for the image.
+func writeImage(c distributorChannels, filename string, world [][]uint8, ages [][]int, p Params, turn int) {
+	c.ioCommand <- ioOutput
+	c.ioFilename <- filename
+	c.ioTurn <- turn
+	if ages != nil {
+		c.ioAges <- ages
 	}
 
-	immutableWorld := makeImmutableWorld(world)
+	// writes image to event channel byte by byte
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			c.ioOutput <- world[y][x]
+		}
+	}
+}
 
-	// divides up world between threads
-	vDiff := p.ImageHeight / p.Threads
-	// handles remainder e.g. if num of threads is odd
-	remainder := p.ImageHeight % p.Threads
+const (
+	// minTurnDelay and maxTurnDelay limit the delay between turns set with the - and + keys
+	minTurnDelay = 16 * time.Millisecond
+	maxTurnDelay = 2 * time.Second
+)
 
-	for i, resChan := range resChans {
-		i += 1
-		// Calculate y bounds for thread
-		y1 := (i - 1) * vDiff
-		y2 := (i * vDiff) - 1
-		if i == p.Threads {
-			y2 += remainder
+// writeCheckpoint sends the world to the io goroutine to be saved along with the turn, without waiting for it to be written.
+func writeCheckpoint(c distributorChannels, world [][]uint8, turn int) {
+	c.ioCommand <- ioCheckpoint
+	c.ioTurn <- turn
+	for _, row := range world {
+		for _, cell := range row {
+			c.ioOutput <- cell
 		}
-
-		go worker(p, y1, y2, immutableWorld, resChan, turn, c.events)
-	}
-	fmt.Println("done")
-	for _, resChan := range resChans {
-		// gets slice from worker and appends to frame
-		// blocks on channels sequentially so no need for wait groups or additional processing for ordering
-		newSlice := <-resChan
-		newWorld = append(newWorld, newSlice...)
 	}
-
-	res <- newWorld
 }
 
-func writeImage(c distributorChannels, filename string, world [][]uint8, p Params, turn int) {
-	c.ioCommand <- ioOutput
-	c.ioFilename <- filename
-
-	// writes image to event channel byte by byte
-	for y := 0; y < p.ImageHeight; y++ {
-		for x := 0; x < p.ImageWidth; x++ {
-			c.ioOutput <- world[y][x]
+// recordFrame sends the world to the io goroutine to be added to the recording.
+func recordFrame(c distributorChannels, world [][]uint8) {
+	c.ioCommand <- ioRecordFrame
+	for _, row := range world {
+		for _, cell := range row {
+			c.ioOutput <- cell
 		}
 	}
+}
 
-	// send image output completed event to user
-	c.events <- ImageOutputComplete{CompletedTurns: turn, Filename: filename}
+// reportInterval returns how often the number of alive cells is reported.
+func reportInterval(p Params) time.Duration {
+	if p.ReportInterval <= 0 {
+		return 2 * time.Second
+	}
+	return p.ReportInterval
 }
 
 // distributor divides the work between workers and interacts with other goroutines.
+// Key presses are only handled between turns, so all the events of a turn are sent before those of a key press:
+//
+//	p pauses or resumes processing, sending StateChange Paused or Executing with the turns completed so far.
+//	s writes the current turn as an image, sending ImageOutputComplete once the file is complete.
+//	  Processing carries on while the file is written, so later turns may complete before it.
+//	q writes the current turn as an image and a checkpoint and ends the run as if it were the last turn,
+//	  sending FinalTurnComplete followed by StateChange Quitting. A broker carries on by itself.
+//	k stops the workers and io straight away without writing an image, sending only StateChange Quitting.
+//	n processes exactly one turn while paused, sending its CellsFlipped and TurnComplete as usual.
+//	- slows processing down to one turn at a time with a delay between them, doubling the delay on each press.
+//	+ halves the delay, going back to full speed once it is below minTurnDelay.
+//	b steps back one turn while paused, or as many turns as the digits typed before it, as far as the history allows.
+//	  It sends the CellsFlipped that restore the earlier world and a TurnComplete with the earlier turn.
+//
+// The image written once the last turn is complete, or q is pressed, is always followed by its ImageOutputComplete
+// and then FinalTurnComplete.
+// Every SnapshotEvery turns the world is written as an image in the same way as when s is pressed.
+// Every RecordEvery turns, starting with the first, the world is added to a recording that is written as an
+// animated gif at the end of the run, unless k is pressed.
+// A run resumed from a checkpoint starts at its turn, so the CompletedTurns of every event carry on from there.
+// AliveCellsCount is sent every ReportInterval between turns, including while paused, so its count always
+// matches its CompletedTurns. It is never sent after the final turn is complete.
+// Any other key presses are ignored, and any left once the last turn is complete are never read.
+// Both the workers and the io goroutine have been told to stop before the events channel is closed.
 func distributor(p Params, c distributorChannels) {
 
-	// TODO: Create a 2D slice to store the world.
-	world := make([][]byte, p.ImageHeight)
-	for i := range world {
-		world[i] = make([]byte, p.ImageWidth)
-	}
-
 	turn := 0
 
-	c.events <- StateChange{turn, Executing}
 	filename := fmt.Sprintf("%vx%v", p.ImageWidth, p.ImageHeight)
-	fmt.Println(filename)
 	c.ioCommand <- ioInput
 	c.ioFilename <- filename
-	// writes image
-	outFilename := fmt.Sprintf("%vx%vx%v", p.ImageWidth, p.ImageHeight, p.Turns)
+
+	// the size of the image is only known up front if it was given in the params
+	header := <-c.ioHeader
+	if header.err != nil {
+		fmt.Println("Failed to read the image:", header.err)
+		close(c.ioCommand)
+		c.events <- StateChange{turn, Quitting}
+		close(c.events)
+		return
+	}
+	p.ImageWidth, p.ImageHeight = header.width, header.height
+	p.Rule, p.Topology, p.Engine = header.rule, header.topology, header.engine
+	turn = header.turn
+
+	world := make([][]byte, p.ImageHeight)
+	for i := range world {
+		world[i] = make([]byte, p.ImageWidth)
+	}
 
 	// Read each cell into world
+	var flipped []util.Cell
 	for y := 0; y < p.ImageHeight; y++ {
 		for x := 0; x < p.ImageWidth; x++ {
 			cell := <-c.ioInput
 			if cell == 255 {
-				c.events <- CellFlipped{CompletedTurns: 0, Cell: util.Cell{X: x, Y: y}}
+				flipped = append(flipped, util.Cell{X: x, Y: y})
 			}
 			world[y][x] = cell
 		}
 	}
 
-	resultChan := make(chan [][]uint8)
-	// TODO: Execute all turns of the Game of Life.
-
-	go calculateNextState(p, c, world, turn, resultChan)
-	for turn < p.Turns {
-		fmt.Println("TURN", turn, p.Turns)
-		newFrame := <-resultChan
-		world = newFrame
-		turn++
-		if turn < p.Turns {
-			go calculateNextState(p, c, world, turn, resultChan)
-		}
+	// the simulation processes the turns from here on until the final state is collected
+	sim, err := newSimulation(p, world, turn, header.session)
+	if err != nil {
+		fmt.Println("Failed to start the simulation:", err)
+		close(c.ioCommand)
+		c.events <- StateChange{turn, Quitting}
+		close(c.events)
+		return
+	}
 
+	// all cells that are alive in the image must be flipped before execution starts
+	if len(flipped) > 0 {
+		c.events <- CellsFlipped{CompletedTurns: turn, Cells: flipped}
+	}
+	c.events <- StateChange{turn, Executing}
+	if p.RecordEvery > 0 && turn%p.RecordEvery == 0 {
+		recordFrame(c, world)
 	}
 
-	writeImage(c, outFilename, world, p, turn)
+	tracker := newAgeTracker(p, world, turn)
+	alive := len(flipped)
+	ticker := time.NewTicker(reportInterval(p))
+	defer ticker.Stop()
+	// checkpoints is nil, so never ready, unless checkpoints are written periodically
+	var checkpoints <-chan time.Time
+	if p.CheckpointInterval > 0 {
+		checkpointTicker := time.NewTicker(p.CheckpointInterval)
+		defer checkpointTicker.Stop()
+		checkpoints = checkpointTicker.C
+	}
+	paused, quit, kill := false, false, false
+	var delay time.Duration
+	var lastTurn time.Time
+	past := newHistory(historySize(p))
+	// count is the number typed before b, or 0 if none has been
+	count := 0
+	for turn < p.Turns && !quit && !kill {
+		// wait for a key press while paused or until the next turn is due, reporting the alive cells meanwhile
+		var key rune
+		wait := delay - time.Since(lastTurn)
+		if paused || wait > 0 {
+			var due <-chan time.Time
+			if !paused {
+				due = time.After(wait)
+			}
+			select {
+			case key = <-c.keyPresses:
+			case <-ticker.C:
+				c.events <- AliveCellsCount{CompletedTurns: turn, CellsCount: alive}
+			case <-checkpoints:
+				writeCheckpoint(c, sim.world(), turn)
+			case <-due:
+			}
+		} else {
+			select {
+			case key = <-c.keyPresses:
+			case <-ticker.C:
+				c.events <- AliveCellsCount{CompletedTurns: turn, CellsCount: alive}
+			case <-checkpoints:
+				writeCheckpoint(c, sim.world(), turn)
+			default:
+			}
+		}
+		step := false
+		switch key {
+		case 'p':
+			paused = !paused
+			if paused {
+				c.events <- StateChange{turn, Paused}
+			} else {
+				c.events <- StateChange{turn, Executing}
+			}
+		case 's':
+			writeImage(c, fmt.Sprintf("%vx%vx%v", p.ImageWidth, p.ImageHeight, turn), sim.world(), tracker.ages(turn), p, turn)
+		case 'q':
+			quit = true
+		case 'k':
+			kill = true
+		case 'n':
+			step = paused
+		case '-':
+			if delay *= 2; delay < minTurnDelay {
+				delay = minTurnDelay
+			} else if delay > maxTurnDelay {
+				delay = maxTurnDelay
+			}
+		case '+':
+			if delay /= 2; delay < minTurnDelay {
+				delay = 0
+			}
+		case 'b':
+			if paused {
+				steps := count
+				if steps == 0 {
+					steps = 1
+				}
+				world := sim.world()
+				flipped, turns := past.rewind(world, steps)
+				if turns > 0 {
+					sim.stop()
+					turn -= turns
+					if sim, err = newSimulation(p, world, turn, 0); err != nil {
+						// the earlier world is still written as if q was pressed, so the run can be resumed from it
+						fmt.Println("Failed to restart the simulation:", err)
+						sim, quit = newWorkerPool(p, world), true
+					}
+					alive = len(calculateAliveCells(p, world))
+					tracker.update(flipped, turn)
+					if len(flipped) > 0 {
+						c.events <- CellsFlipped{CompletedTurns: turn, Cells: flipped}
+					}
+					c.events <- TurnComplete{CompletedTurns: turn}
+				}
+			}
+		}
+		if key >= '0' && key <= '9' {
+			count = count*10 + int(key-'0')
+		} else if key != 0 {
+			count = 0
+		}
+		if quit || kill || (paused && !step) || (!paused && time.Since(lastTurn) < delay) {
+			continue
+		}
 
-	// TODO: Report the final state using FinalTurnCompleteEvent.
-	liveCells := calculateAliveCells(p, world)
-	c.events <- FinalTurnComplete{CompletedTurns: turn, Alive: liveCells}
+		// single steps and throttled turns are processed one at a time, and no turn with a snapshot or frame is skipped
+		limit := p.Turns - turn
+		if step || delay > 0 {
+			limit = 1
+		}
+		for _, every := range []int{p.SnapshotEvery, p.RecordEvery} {
+			if every > 0 && every-turn%every < limit {
+				limit = every - turn%every
+			}
+		}
+		lastTurn = time.Now()
+		var turns int
+		turns, flipped, alive = sim.advance(limit)
+		if err := sim.err(); err != nil {
+			// the world of the last turn completed is still written as if q was pressed, so the run can be resumed from it
+			fmt.Println("The simulation failed:", err)
+			quit = true
+			continue
+		}
+		if r, ok := sim.(recoverer); ok {
+			for _, event := range r.recovered() {
+				c.events <- event
+			}
+		}
+		turn += turns
+		past.push(turns, flipped)
+		tracker.update(flipped, turn)
+		if len(flipped) > 0 {
+			c.events <- CellsFlipped{CompletedTurns: turn, Cells: flipped}
+		}
+		c.events <- TurnComplete{CompletedTurns: turn}
+		if p.SnapshotEvery > 0 && turn%p.SnapshotEvery == 0 && turn < p.Turns {
+			writeImage(c, fmt.Sprintf("%vx%vx%v", p.ImageWidth, p.ImageHeight, turn), sim.world(), tracker.ages(turn), p, turn)
+		}
+		if p.RecordEvery > 0 && turn%p.RecordEvery == 0 {
+			recordFrame(c, sim.world())
+		}
+	}
+	if kill {
+		sim.stop()
+	} else {
+		world = sim.world()
+		if d, ok := sim.(detacher); ok && quit {
+			d.detach()
+		} else {
+			sim.stop()
+		}
+		writeImage(c, fmt.Sprintf("%vx%vx%v", p.ImageWidth, p.ImageHeight, turn), world, tracker.ages(turn), p, turn)
+		if quit {
+			writeCheckpoint(c, world, turn)
+		}
+		if p.RecordEvery > 0 {
+			c.ioCommand <- ioWriteRecording
+			c.ioTurn <- turn
+		}
+		// unlike snapshots, the final image is complete before FinalTurnComplete is sent
+		c.ioCommand <- ioCheckIdle
+		<-c.ioIdle
+		c.events <- FinalTurnComplete{CompletedTurns: turn, Alive: calculateAliveCells(p, world)}
+	}
 
 	// Make sure that the Io has finished any output before exiting.
 	c.ioCommand <- ioCheckIdle
 	<-c.ioIdle
+	close(c.ioCommand)
 
 	c.events <- StateChange{turn, Quitting}
 
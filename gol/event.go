@@ -2,6 +2,7 @@ package gol
 
 import (
 	"fmt"
+	"strings"
 
 	"uk.ac.bris.cs/gameoflife/util"
 )
@@ -16,7 +17,7 @@ type Event interface {
 }
 
 // `AliveCellsCount` is an Event notifying the user about the number of currently alive cells.
-// This Event should be sent every 2s.
+// This Event should be sent every Params.ReportInterval, which defaults to 2s.
 type AliveCellsCount struct { // implements Event
 	CompletedTurns int
 	CellsCount     int
@@ -78,6 +79,15 @@ type FinalTurnComplete struct {
 	Alive          []util.Cell
 }
 
+// `WorkersRecovered` is an Event notifying the user that remote workers have failed.
+// The rest of the workers carried on from the world at CompletedTurns, so the turns since are processed again.
+// This Event is only sent when a broker is used.
+type WorkersRecovered struct { // implements Event
+	CompletedTurns int
+	Failed         []string
+	Workers        int
+}
+
 // String methods allow the different types of Events and States to be printed.
 
 func (state State) String() string {
@@ -149,6 +159,14 @@ func (event FinalTurnComplete) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event WorkersRecovered) String() string {
+	return fmt.Sprintf("Workers %v Failed, Carrying On With %v", strings.Join(event.Failed, ", "), event.Workers)
+}
+
+func (event WorkersRecovered) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 // This might all seem like weird syntax to you...
 // You have however seen something similar to it before in first year.
 
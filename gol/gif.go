@@ -0,0 +1,187 @@
+package gol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"time"
+)
+
+// recording writes frames of the world to an animated gif as they arrive, so only the current frame is ever
+// kept in memory. Each frame is encoded by image/gif on its own and only its image data is added to the file.
+// The gif is written to a temporary file that is renamed once the run is over and its final turn is known.
+type recording struct {
+	file  *os.File
+	out   *bufio.Writer
+	scale int
+	// delay is in hundredths of a second, as used by the gif format
+	delay  int
+	frames int
+	// err is the first error writing the file, after which frames are dropped
+	err error
+}
+
+// recordPalette shows dead cells as black and alive cells as white, like pgm images.
+var recordPalette = color.Palette{color.Black, color.White}
+
+// gifHeadSize is the length of what image/gif writes before the first frame when there is a global colour table
+// of recordPalette: the signature, the logical screen descriptor and the two colours of the table.
+const gifHeadSize = 6 + 7 + 2*3
+
+// gifTrailer is the byte that ends a gif.
+const gifTrailer = 0x3b
+
+// recordDelay rounds the delay between frames to the nearest hundredth of a second, as a gif can not show
+// frames for any less. A delay of zero means the default of 100ms.
+func recordDelay(p Params) int {
+	if p.RecordDelay == 0 {
+		return 10
+	}
+	delay := int((p.RecordDelay + 5*time.Millisecond) / (10 * time.Millisecond))
+	if delay < 1 {
+		return 1
+	}
+	return delay
+}
+
+// newRecording creates the temporary file that the frames are written to.
+func newRecording(p Params) *recording {
+	r := &recording{scale: p.RecordScale, delay: recordDelay(p)}
+	if r.scale <= 0 {
+		r.scale = 1
+	}
+	_ = os.Mkdir("out", os.ModePerm)
+	r.file, r.err = os.CreateTemp("out", fmt.Sprintf("%vx%v.gif.*", p.ImageWidth, p.ImageHeight))
+	if r.err == nil {
+		r.out = bufio.NewWriter(r.file)
+	}
+	return r
+}
+
+// addFrame writes the world as the next frame, with each cell drawn as a square scale pixels wide.
+func (r *recording) addFrame(world [][]uint8) {
+	if r.err != nil {
+		return
+	}
+	height := len(world)
+	width := 0
+	if height > 0 {
+		width = len(world[0])
+	}
+	frame := image.NewPaletted(image.Rect(0, 0, width*r.scale, height*r.scale), recordPalette)
+	for y, row := range world {
+		for x, cell := range row {
+			if cell != 255 {
+				continue
+			}
+			for j := 0; j < r.scale; j++ {
+				start := frame.PixOffset(x*r.scale, y*r.scale+j)
+				for i := 0; i < r.scale; i++ {
+					frame.Pix[start+i] = 1
+				}
+			}
+		}
+	}
+
+	var encoded []uint8
+	encoded, r.err = encodeFrames(frame, r.delay, 1)
+	if r.err != nil {
+		return
+	}
+	data := encoded[gifHeadSize : len(encoded)-1]
+	if r.frames == 0 {
+		// the first frame is encoded twice over so that image/gif also writes the start of the file,
+		// including the block that makes the animation loop, and everything before the second copy is kept
+		var twice []uint8
+		twice, r.err = encodeFrames(frame, r.delay, 2)
+		if r.err != nil {
+			return
+		}
+		data = twice[:len(twice)-1-len(data)]
+	}
+	if _, r.err = r.out.Write(data); r.err == nil {
+		r.frames++
+	}
+}
+
+// encodeFrames encodes an animated gif that shows the frame the given number of times.
+func encodeFrames(frame *image.Paletted, delay, copies int) ([]uint8, error) {
+	g := &gif.GIF{Config: image.Config{ColorModel: recordPalette, Width: frame.Rect.Dx(), Height: frame.Rect.Dy()}}
+	for i := 0; i < copies; i++ {
+		g.Image, g.Delay = append(g.Image, frame), append(g.Delay, delay)
+	}
+	var b bytes.Buffer
+	if err := gif.EncodeAll(&b, g); err != nil {
+		return nil, err
+	}
+	encoded := b.Bytes()
+	if len(encoded) <= gifHeadSize || encoded[len(encoded)-1] != gifTrailer {
+		return nil, fmt.Errorf("image/gif did not write a gif with a global colour table")
+	}
+	return encoded, nil
+}
+
+// finish ends the gif and moves it to the path, returning the first error writing it.
+func (r *recording) finish(path string) error {
+	if r.file == nil {
+		return r.err
+	}
+	if r.err == nil {
+		r.out.WriteByte(gifTrailer)
+		r.err = r.out.Flush()
+	}
+	if err := r.file.Close(); r.err == nil {
+		r.err = err
+	}
+	if r.err == nil {
+		r.err = os.Rename(r.file.Name(), path)
+	}
+	if r.err != nil {
+		os.Remove(r.file.Name())
+	}
+	return r.err
+}
+
+// discard removes the temporary file of a recording that will never be finished.
+func (r *recording) discard() {
+	if r.file != nil {
+		r.file.Close()
+		os.Remove(r.file.Name())
+	}
+}
+
+// recordFrame receives the world from the distributor and adds it to the recording.
+func (io *ioState) recordFrame() {
+	world := make([][]byte, io.params.ImageHeight)
+	for y := range world {
+		world[y] = make([]byte, io.params.ImageWidth)
+		for x := range world[y] {
+			world[y][x] = <-io.channels.output
+		}
+	}
+	if io.recording == nil {
+		io.recording = newRecording(io.params)
+	}
+	io.recording.addFrame(world)
+}
+
+// writeRecording receives the final turn from the distributor and finishes the animated gif of every frame recorded so far.
+func (io *ioState) writeRecording() {
+	turn := <-io.channels.turn
+	if io.recording == nil {
+		return
+	}
+	path := fmt.Sprintf("out/%vx%vx%v.gif", io.params.ImageWidth, io.params.ImageHeight, turn)
+	frames := io.recording.frames
+	err := io.recording.finish(path)
+	io.recording = nil
+	if err != nil {
+		fmt.Println("Failed to write the recording:", err)
+		return
+	}
+	fmt.Println("Recording", path, "with", frames, "frames done!")
+}
@@ -1,11 +1,94 @@
 package gol
 
+import (
+	"fmt"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
 // Params provides the details of how to run the Game of Life and which image to load.
+// If InputFile is set the image is loaded from that path instead of images/, and a zero
+// ImageWidth or ImageHeight is replaced by the size given in the header of the image.
+// Pixels at least Threshold of the maximum value of the image are alive, with 0 meaning half.
+// Pattern files such as .rle are placed at PatternOffset, or in the centre of the world if it is nil,
+// and their rule is used unless Rule is set. Images are written in OutputFormat, which defaults to pgm.
+// Png images are drawn with each cell PngScale pixels wide in the colours of Palette, which default to 1 and grey.
+// The number of alive cells is reported every ReportInterval, which defaults to 2s.
+// If Resume is set the world, turn and rule are read from that checkpoint file instead of an image,
+// and the run carries on until Turns. A checkpoint is written when q is pressed and every CheckpointInterval, if it is not zero.
+// If SnapshotEvery is not zero the world is also written as an image every SnapshotEvery turns.
+// If Compress is set images and checkpoints are written with gzip and end in .gz. Input files ending in .gz are always decompressed.
+// If RecordEvery is not zero every RecordEvery turns are recorded as an animated gif, with each cell drawn
+// RecordScale pixels wide and RecordDelay between frames, which default to 1 and 100ms.
+// If Broker is set the turns are processed by the remote workers of the broker at that address instead of locally,
+// which can use any engine but hashlife.
+// If Attach is also set the world, turn, size, rule, topology and engine are taken from the simulation already running
+// on the broker instead of an image, and a Turns that is not zero replaces the last turn the broker processes by itself.
+// The changes made by the last History advances are kept for stepping backwards, 100 if it is zero and none if it is negative.
 type Params struct {
-	Turns       int
-	Threads     int
-	ImageWidth  int
-	ImageHeight int
+	Turns              int
+	Threads            int
+	ImageWidth         int
+	ImageHeight        int
+	InputFile          string
+	Threshold          float64
+	PatternOffset      *util.Cell
+	OutputFormat       string
+	Engine             Engine
+	Rule               Rule
+	Topology           Topology
+	ReportInterval     time.Duration
+	History            int
+	Resume             string
+	CheckpointInterval time.Duration
+	SnapshotEvery      int
+	RecordEvery        int
+	RecordScale        int
+	RecordDelay        time.Duration
+	PngScale           int
+	Palette            string
+	Compress           bool
+	Broker             string
+	Attach             bool
+}
+
+// Engine selects how the workers store the world while calculating the next state.
+type Engine int
+
+const (
+	// ByteEngine stores every cell in its own byte.
+	ByteEngine Engine = iota
+	// PackedEngine stores 64 cells in each word and calculates all of them at once.
+	PackedEngine
+	// HashLifeEngine stores the world as a quadtree and skips many turns at a time by remembering
+	// how every square it has seen before evolves. It only supports square tori with a power of two size,
+	// and any other world fails to start.
+	HashLifeEngine
+)
+
+var engineNames = map[Engine]string{
+	ByteEngine:     "bytes",
+	PackedEngine:   "packed",
+	HashLifeEngine: "hashlife",
+}
+
+func (engine Engine) String() string {
+	if name, ok := engineNames[engine]; ok {
+		return name
+	}
+	return "Incorrect Engine"
+}
+
+// Set allows an Engine to be chosen by name using the flag package.
+func (engine *Engine) Set(name string) error {
+	for e, n := range engineNames {
+		if n == name {
+			*engine = e
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown engine %q", name)
 }
 
 // Run starts the processing of Game of Life. It should initialise channels and goroutines.
@@ -16,15 +99,22 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 	ioCommand := make(chan ioCommand)
 	ioIdle := make(chan bool)
 	ioFilename := make(chan string)
+	ioTurn := make(chan int)
+	ioAges := make(chan [][]int)
 	ioOutput := make(chan uint8)
 	ioInput := make(chan uint8)
+	ioHeader := make(chan imageHeader)
 
 	ioChannels := ioChannels{
 		command:  ioCommand,
 		idle:     ioIdle,
+		events:   events,
 		filename: ioFilename,
+		turn:     ioTurn,
+		ages:     ioAges,
 		output:   ioOutput,
 		input:    ioInput,
+		header:   ioHeader,
 	}
 	go startIo(p, ioChannels)
 
@@ -33,8 +123,12 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 		ioCommand:  ioCommand,
 		ioIdle:     ioIdle,
 		ioFilename: ioFilename,
+		ioTurn:     ioTurn,
+		ioAges:     ioAges,
 		ioOutput:   ioOutput,
 		ioInput:    ioInput,
+		ioHeader:   ioHeader,
+		keyPresses: keyPresses,
 	}
 	distributor(p, distributorChannels)
 }
@@ -0,0 +1,271 @@
+package gol
+
+import (
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// node is a square of the world 2^level cells wide, stored as a quadtree.
+// Nodes are never modified once created and identical squares share the same node,
+// so the result of advancing a node can be remembered and reused wherever it appears.
+type node struct {
+	nw, ne, sw, se *node
+	level          uint
+	// population may overflow for the tiled nodes far above the level of the world, but it is never used for them
+	population int
+	// results[j] is the centre of the node after 2^j turns, if it has been calculated
+	results []*node
+}
+
+// hashLife advances a torus whose width and height are the same power of two, many turns at a time.
+// The world is tiled with copies of itself so that the infinite plane the algorithm works on behaves
+// like a torus, and the step size doubles while turns are cheap to calculate.
+type hashLife struct {
+	rule     Rule
+	size     int
+	level    uint
+	dead     *node
+	alive    *node
+	nodes    map[[4]*node]*node
+	root     *node
+	exponent uint
+}
+
+const (
+	// the step size doubles after a jump faster than hashLifeFast and halves after one slower than hashLifeSlow
+	hashLifeFast = 20 * time.Millisecond
+	hashLifeSlow = 250 * time.Millisecond
+	// all nodes are forgotten once there are more than hashLifeMaxNodes, to stop chaotic patterns using up all the memory
+	hashLifeMaxNodes = 1 << 22
+)
+
+// canHashLife returns whether the hashLife engine is able to simulate the world described by p.
+func canHashLife(p Params) bool {
+	size := p.ImageWidth
+	return p.Topology == Torus && p.ImageWidth == p.ImageHeight && size >= 4 && size&(size-1) == 0
+}
+
+func newHashLife(p Params, world [][]uint8) *hashLife {
+	h := &hashLife{
+		rule: p.Rule.orDefault(),
+		size: p.ImageWidth,
+	}
+	for 1<<h.level < h.size {
+		h.level++
+	}
+	h.reset(world)
+	return h
+}
+
+// reset forgets every node and result, and builds the quadtree of the world again.
+func (h *hashLife) reset(world [][]uint8) {
+	h.nodes = make(map[[4]*node]*node)
+	h.dead = &node{}
+	h.alive = &node{population: 1}
+	h.root = h.build(world, 0, 0, h.level)
+}
+
+func (h *hashLife) build(world [][]uint8, x, y int, level uint) *node {
+	if level == 0 {
+		if world[y][x] == 255 {
+			return h.alive
+		}
+		return h.dead
+	}
+	half := 1 << (level - 1)
+	return h.join(
+		h.build(world, x, y, level-1),
+		h.build(world, x+half, y, level-1),
+		h.build(world, x, y+half, level-1),
+		h.build(world, x+half, y+half, level-1),
+	)
+}
+
+// join returns the node made of four quadrants, reusing an identical node if one already exists.
+func (h *hashLife) join(nw, ne, sw, se *node) *node {
+	key := [4]*node{nw, ne, sw, se}
+	if n, ok := h.nodes[key]; ok {
+		return n
+	}
+	n := &node{
+		nw: nw, ne: ne, sw: sw, se: se,
+		level:      nw.level + 1,
+		population: nw.population + ne.population + sw.population + se.population,
+	}
+	h.nodes[key] = n
+	return n
+}
+
+// centre returns the node half the size in the middle of n.
+func (h *hashLife) centre(n *node) *node {
+	return h.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+}
+
+// base calculates one turn of the middle 2x2 cells of a 4x4 node.
+func (h *hashLife) base(n *node) *node {
+	var cells [4][4]bool
+	for y, row := range [2][2]*node{{n.nw, n.ne}, {n.sw, n.se}} {
+		for x, quadrant := range row {
+			for dy, r := range [2][2]*node{{quadrant.nw, quadrant.ne}, {quadrant.sw, quadrant.se}} {
+				for dx, leaf := range r {
+					cells[y*2+dy][x*2+dx] = leaf == h.alive
+				}
+			}
+		}
+	}
+	var next [2][2]*node
+	for y := 1; y <= 2; y++ {
+		for x := 1; x <= 2; x++ {
+			aliveNeighbours := 0
+			for j := -1; j <= 1; j++ {
+				for i := -1; i <= 1; i++ {
+					if (i != 0 || j != 0) && cells[y+j][x+i] {
+						aliveNeighbours++
+					}
+				}
+			}
+			next[y-1][x-1] = h.dead
+			if h.rule.Next(cells[y][x], aliveNeighbours) {
+				next[y-1][x-1] = h.alive
+			}
+		}
+	}
+	return h.join(next[0][0], next[0][1], next[1][0], next[1][1])
+}
+
+// result returns the centre of n after 2^j turns, where j is at most n.level-2.
+func (h *hashLife) result(n *node, j uint) *node {
+	if n.results == nil {
+		n.results = make([]*node, n.level-1)
+	}
+	if r := n.results[j]; r != nil {
+		return r
+	}
+
+	var r *node
+	if n.level == 2 {
+		r = h.base(n)
+	} else {
+		// the nine overlapping squares half the size of n
+		n00, n01, n02 := n.nw, h.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw), n.ne
+		n10 := h.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne)
+		n11 := h.centre(n)
+		n12 := h.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne)
+		n20, n21, n22 := n.sw, h.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw), n.se
+
+		// at full speed both halves of the recursion advance, otherwise only the second one does
+		first := func(m *node) *node {
+			if j == n.level-2 {
+				return h.result(m, j-1)
+			}
+			return h.centre(m)
+		}
+		second := j
+		if j == n.level-2 {
+			second = j - 1
+		}
+		c00, c01, c02 := first(n00), first(n01), first(n02)
+		c10, c11, c12 := first(n10), first(n11), first(n12)
+		c20, c21, c22 := first(n20), first(n21), first(n22)
+		r = h.join(
+			h.result(h.join(c00, c01, c10, c11), second),
+			h.result(h.join(c01, c02, c11, c12), second),
+			h.result(h.join(c10, c11, c20, c21), second),
+			h.result(h.join(c11, c12, c21, c22), second),
+		)
+	}
+	n.results[j] = r
+	return r
+}
+
+// jump advances the world by exactly 2^k turns.
+func (h *hashLife) jump(k uint) {
+	// tile the world until the tiled node is big enough to advance 2^k turns
+	tiled := h.root
+	for tiled.level < h.level+1 || tiled.level < k+2 {
+		tiled = h.join(tiled, tiled, tiled, tiled)
+	}
+	r := h.result(tiled, k)
+
+	// the result starts 2^(level-2) cells into the tiling, which is either a multiple of
+	// the size of the world or exactly half of it, in which case the quadrants are swapped back
+	if tiled.level == h.level+1 {
+		h.root = h.join(r.se, r.sw, r.ne, r.nw)
+		return
+	}
+	for r.level > h.level {
+		r = r.nw
+	}
+	h.root = r
+}
+
+// advance jumps as many turns as the current step size allows without going past the given number of turns.
+func (h *hashLife) advance(turns int) (int, []util.Cell, int) {
+	k := h.exponent
+	for 1<<k > turns {
+		k--
+	}
+
+	start := time.Now()
+	old := h.root
+	h.jump(k)
+	elapsed := time.Since(start)
+
+	if elapsed < hashLifeFast && k == h.exponent && k < 62 {
+		h.exponent++
+	} else if elapsed > hashLifeSlow && h.exponent > 0 {
+		h.exponent--
+	}
+
+	flipped := h.diff(old, h.root, 0, 0, nil)
+	if len(h.nodes) > hashLifeMaxNodes {
+		h.reset(h.world())
+	}
+	return 1 << k, flipped, h.root.population
+}
+
+// diff appends the cells that are different between two nodes of the same level.
+func (h *hashLife) diff(a, b *node, x, y int, flipped []util.Cell) []util.Cell {
+	if a == b {
+		return flipped
+	}
+	if a.level == 0 {
+		return append(flipped, util.Cell{X: x, Y: y})
+	}
+	half := 1 << (a.level - 1)
+	flipped = h.diff(a.nw, b.nw, x, y, flipped)
+	flipped = h.diff(a.ne, b.ne, x+half, y, flipped)
+	flipped = h.diff(a.sw, b.sw, x, y+half, flipped)
+	return h.diff(a.se, b.se, x+half, y+half, flipped)
+}
+
+func (h *hashLife) world() [][]uint8 {
+	world := make([][]uint8, h.size)
+	for i := range world {
+		world[i] = make([]uint8, h.size)
+	}
+	h.expand(h.root, world, 0, 0)
+	return world
+}
+
+func (h *hashLife) expand(n *node, world [][]uint8, x, y int) {
+	if n.population == 0 {
+		return
+	}
+	if n.level == 0 {
+		world[y][x] = 255
+		return
+	}
+	half := 1 << (n.level - 1)
+	h.expand(n.nw, world, x, y)
+	h.expand(n.ne, world, x+half, y)
+	h.expand(n.sw, world, x, y+half)
+	h.expand(n.se, world, x+half, y+half)
+}
+
+func (h *hashLife) stop() {}
+
+func (h *hashLife) err() error {
+	return nil
+}
@@ -0,0 +1,89 @@
+package gol
+
+import (
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// historyEntry is the change made to the world by a single advance of the simulation.
+type historyEntry struct {
+	turns   int
+	flipped []util.Cell
+}
+
+// history is a ring buffer of the most recent changes to the world, so that they can be undone.
+// Once it is full the oldest change is forgotten to make room for the next one.
+type history struct {
+	entries []historyEntry
+	start   int
+	length  int
+}
+
+// newHistory makes a history that remembers up to size advances, or none at all if size is zero.
+func newHistory(size int) *history {
+	return &history{entries: make([]historyEntry, size)}
+}
+
+// historySize returns how many advances are remembered for stepping backwards.
+func historySize(p Params) int {
+	if p.History < 0 {
+		return 0
+	}
+	if p.History == 0 {
+		return 100
+	}
+	return p.History
+}
+
+// push remembers the cells flipped by an advance of the given number of turns.
+func (h *history) push(turns int, flipped []util.Cell) {
+	if len(h.entries) == 0 {
+		return
+	}
+	i := (h.start + h.length) % len(h.entries)
+	h.entries[i] = historyEntry{turns: turns, flipped: flipped}
+	if h.length < len(h.entries) {
+		h.length++
+	} else {
+		h.start = (h.start + 1) % len(h.entries)
+	}
+}
+
+// pop forgets the most recent change and returns it.
+func (h *history) pop() (historyEntry, bool) {
+	if h.length == 0 {
+		return historyEntry{}, false
+	}
+	h.length--
+	i := (h.start + h.length) % len(h.entries)
+	e := h.entries[i]
+	h.entries[i] = historyEntry{}
+	return e, true
+}
+
+// rewind undoes the most recent changes to the world in place until at least n turns have been undone
+// or there are no changes left. Advances of many turns at once are undone as a whole, so more than n
+// turns may be undone. It returns the cells that are different afterwards and the number of turns undone.
+func (h *history) rewind(world [][]uint8, n int) ([]util.Cell, int) {
+	// a cell flipped an even number of times ends up as it started
+	changed := make(map[util.Cell]bool)
+	turns := 0
+	for turns < n {
+		e, ok := h.pop()
+		if !ok {
+			break
+		}
+		for _, cell := range e.flipped {
+			world[cell.Y][cell.X] = ^world[cell.Y][cell.X]
+			changed[cell] = !changed[cell]
+		}
+		turns += e.turns
+	}
+
+	var flipped []util.Cell
+	for cell, odd := range changed {
+		if odd {
+			flipped = append(flipped, cell)
+		}
+	}
+	return flipped, turns
+}
@@ -2,25 +2,44 @@ package gol
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"strconv"
-	"strings"
+
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
 type ioChannels struct {
 	command <-chan ioCommand
 	idle    chan<- bool
+	events  chan<- Event
 
 	filename <-chan string
+	turn     <-chan int
+	ages     <-chan [][]int
 	output   <-chan uint8
 	input    chan<- uint8
+	header   chan<- imageHeader
+}
+
+// imageHeader is sent to the distributor before the cells of an image, so it knows the size of the world.
+// turn is only non-zero when resuming from a checkpoint or attaching to a broker, and session is only set when attaching.
+// The topology and engine only differ from those in the params when attaching.
+type imageHeader struct {
+	width, height int
+	rule          Rule
+	topology      Topology
+	engine        Engine
+	turn          int
+	session       int
+	err           error
 }
 
 // ioState is the internal ioState of the io goroutine.
 type ioState struct {
 	params   Params
 	channels ioChannels
+	// recording is nil until the first frame is recorded, and again once it is written
+	recording *recording
 }
 
 // ioCommand allows requesting behaviour from the io (pgm) goroutine.
@@ -31,31 +50,30 @@ type ioCommand uint8
 //		ioOutput 	= 0
 //		ioInput 	= 1
 //		ioCheckIdle = 2
+//		ioCheckpoint = 3
+//		ioRecordFrame = 4
+//		ioWriteRecording = 5
 const (
 	ioOutput ioCommand = iota
 	ioInput
 	ioCheckIdle
+	ioCheckpoint
+	ioRecordFrame
+	ioWriteRecording
 )
 
-// writePgmImage receives an array of bytes and writes it to a pgm file.
-func (io *ioState) writePgmImage() {
+// writeImage receives an array of bytes and writes it to a file in the output format,
+// sending ImageOutputComplete once the file is complete.
+func (io *ioState) writeImage() {
 	_ = os.Mkdir("out", os.ModePerm)
 
 	// Request a filename from the distributor.
 	filename := <-io.channels.filename
-
-	file, ioError := os.Create("out/" + filename + ".pgm")
-	util.Check(ioError)
-	defer file.Close()
-
-	_, _ = file.WriteString("P5\n")
-	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
-	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
-	_, _ = file.WriteString("\n")
-	_, _ = file.WriteString(strconv.Itoa(255))
-	_, _ = file.WriteString("\n")
+	turn := <-io.channels.turn
+	var ages [][]int
+	if needsAges(io.params) {
+		ages = <-io.channels.ages
+	}
 
 	world := make([][]byte, io.params.ImageHeight)
 	for i := range world {
@@ -64,64 +82,228 @@ func (io *ioState) writePgmImage() {
 
 	for y := 0; y < io.params.ImageHeight; y++ {
 		for x := 0; x < io.params.ImageWidth; x++ {
-			val := <-io.channels.output
-			//if val != 0 {
-			//	fmt.Println(x, y)
-			//}
-			world[y][x] = val
+			world[y][x] = <-io.channels.output
 		}
 	}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			_, ioError = file.Write([]byte{world[y][x]})
-			util.Check(ioError)
-		}
+	format := outputFormat(io.params)
+	file, ioError := os.Create("out/" + filename + "." + outputExtension(format) + compressedExtension(io.params))
+	util.Check(ioError)
+	defer file.Close()
+	out, finish := compressOutput(file, io.params.Compress)
+
+	switch format {
+	case "rle":
+		ioError = encodeRle(out, world, io.params.Rule)
+	case "cells":
+		ioError = encodeCells(out, world, filename)
+	case "lif":
+		ioError = encodeLife106(out, world)
+	case "mc":
+		ioError = encodeMacrocell(out, world, io.params.Rule)
+	case "pbm", "plainpbm":
+		ioError = encodePbm(out, world, format == "plainpbm")
+	case "png":
+		ioError = encodePng(out, world, ages, io.params.PngScale, paletteName(io.params))
+	default:
+		ioError = encodePgm(out, world)
 	}
+	util.Check(ioError)
+	util.Check(finish())
 
 	ioError = file.Sync()
 	util.Check(ioError)
 
 	fmt.Println("File", filename, "output done!")
+	io.channels.events <- ImageOutputComplete{CompletedTurns: turn, Filename: filename}
+}
+
+// outputFormat returns the format that images are written in.
+func outputFormat(p Params) string {
+	if p.OutputFormat == "" {
+		return "pgm"
+	}
+	return p.OutputFormat
+}
+
+// outputExtension returns the file extension of images written in the given format.
+func outputExtension(format string) string {
+	if format == "plainpbm" {
+		return "pbm"
+	}
+	return format
+}
+
+// CheckOutputFormat returns an error if images can not be written in the given format.
+func CheckOutputFormat(format string) error {
+	switch format {
+	case "", "pgm", "rle", "cells", "lif", "mc", "png", "pbm", "plainpbm":
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q", format)
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
-func (io *ioState) readPgmImage() {
+// readImage opens an image or pattern file and sends its size followed by its data as an array of bytes.
+// If the width and height in the params are zero they are taken from the file instead.
+// When resuming, the world and turn are read from the checkpoint file in the params instead,
+// and when attaching they are received from the broker.
+// If the file can not be read the error is sent to the distributor in place of the size.
+func (io *ioState) readImage() {
 
 	// Request a filename from the distributor.
 	filename := <-io.channels.filename
 
-	data, ioError := os.ReadFile("images/" + filename + ".pgm")
-	util.Check(ioError)
+	var image []uint8
+	var err error
+	turn, session := 0, 0
+	if io.params.Attach {
+		image, turn, session, err = io.attach()
+	} else if io.params.Resume != "" {
+		image, turn, err = io.resume(io.params.Resume)
+	} else {
+		path := "images/" + filename + ".pgm"
+		if io.params.InputFile != "" {
+			path = io.params.InputFile
+		}
+		image, err = io.decode(path)
+	}
+	if err != nil {
+		io.channels.header <- imageHeader{err: err}
+		return
+	}
 
-	fields := strings.Fields(string(data))
+	io.channels.header <- imageHeader{width: io.params.ImageWidth, height: io.params.ImageHeight, rule: io.params.Rule,
+		topology: io.params.Topology, engine: io.params.Engine, turn: turn, session: session}
+	for _, b := range image {
+		io.channels.input <- b
+	}
 
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
+	fmt.Println("File", filename, "input done!")
+}
+
+// decode reads every cell of the file, choosing the format from its extension.
+// Files ending in .gz are decompressed first, with the format chosen from the extension before it.
+func (io *ioState) decode(path string) ([]uint8, error) {
+	file, ext, err := openInput(path)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 
-	width, _ := strconv.Atoi(fields[1])
-	if width != io.params.ImageWidth {
-		panic("Incorrect width")
+	var image []uint8
+	p, err := decodePattern(file, ext, false)
+	if err == nil {
+		if p != nil {
+			image, err = io.place(p)
+		} else {
+			image, err = io.decodePgm(file)
+		}
 	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return image, nil
+}
 
-	height, _ := strconv.Atoi(fields[2])
-	if height != io.params.ImageHeight {
-		panic("Incorrect height")
+// decodePattern reads a pattern in the format given by the extension, or returns nil if it is not a pattern format.
+// If sizeOnly is set the pattern only has its size and rule, without any cells.
+func decodePattern(r io.Reader, ext string, sizeOnly bool) (*pattern, error) {
+	switch ext {
+	case ".rle":
+		return decodeRle(r, sizeOnly)
+	case ".cells":
+		return decodeCells(r, sizeOnly)
+	case ".lif", ".life":
+		return decodeLife106(r, sizeOnly)
+	case ".mc":
+		return decodeMacrocell(r, sizeOnly)
 	}
+	return nil, nil
+}
 
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
+func (io *ioState) decodePgm(file io.Reader) ([]uint8, error) {
+	d := newPgmDecoder(file)
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	if err := io.setSize(d.width, d.height); err != nil {
+		return nil, err
 	}
+	return d.readCells(io.params.Threshold)
+}
 
-	image := []byte(fields[4])
+// place puts a pattern into an empty world at the offset given in the params.
+// Without an offset the pattern is centred, unless it is anchored to the top left corner.
+// The rule of the pattern is used if the params do not give one.
+func (io *ioState) place(p *pattern) ([]uint8, error) {
+	if io.params.ImageWidth == 0 && io.params.ImageHeight == 0 {
+		if p.width == 0 || p.height == 0 {
+			return nil, fmt.Errorf("the pattern is empty so the size of the world must be given")
+		}
+		if err := io.setSize(p.width, p.height); err != nil {
+			return nil, err
+		}
+	}
+	if io.params.Rule == (Rule{}) {
+		io.params.Rule = p.rule
+	}
 
-	for _, b := range image {
-		io.channels.input <- b
+	width, height := io.params.ImageWidth, io.params.ImageHeight
+	offset := util.Cell{X: (width - p.width) / 2, Y: (height - p.height) / 2}
+	if p.anchored {
+		offset = util.Cell{}
+	}
+	if io.params.PatternOffset != nil {
+		offset = *io.params.PatternOffset
+	}
+	if offset.X < 0 || offset.Y < 0 || offset.X+p.width > width || offset.Y+p.height > height {
+		return nil, fmt.Errorf("the %vx%v pattern does not fit in the %vx%v world at (%v, %v)",
+			p.width, p.height, width, height, offset.X, offset.Y)
 	}
 
-	fmt.Println("File", filename, "input done!")
+	image := make([]uint8, width*height)
+	for _, cell := range p.cells {
+		image[(offset.Y+cell.Y)*width+offset.X+cell.X] = 255
+	}
+	return image, nil
+}
+
+// setSize takes the size of the world from an image being input, unless the params already give a different size.
+func (io *ioState) setSize(width, height int) error {
+	if (io.params.ImageWidth != 0 && io.params.ImageWidth != width) ||
+		(io.params.ImageHeight != 0 && io.params.ImageHeight != height) {
+		return fmt.Errorf("the image is %vx%v but %vx%v was expected", width, height, io.params.ImageWidth, io.params.ImageHeight)
+	}
+	io.params.ImageWidth, io.params.ImageHeight = width, height
+	return nil
+}
+
+// ImageSize reads the width and height of an image or pattern file.
+// Only the header of an image is read, and the cells of a pattern are not kept.
+func ImageSize(path string) (width, height int, err error) {
+	file, ext, err := openInput(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	p, err := decodePattern(file, ext, true)
+	if err == nil {
+		if p != nil {
+			width, height = p.width, p.height
+			if width == 0 || height == 0 {
+				err = fmt.Errorf("the pattern is empty so the size of the world must be given")
+			}
+		} else {
+			d := newPgmDecoder(file)
+			err = d.readHeader()
+			width, height = d.width, d.height
+		}
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("%v: %v", path, err)
+	}
+	return width, height, nil
 }
 
 // startIo should be the entrypoint of the io goroutine.
@@ -135,11 +317,21 @@ func startIo(p Params, c ioChannels) {
 		// Block and wait for requests from the distributor
 		switch command {
 		case ioInput:
-			io.readPgmImage()
+			io.readImage()
 		case ioOutput:
-			io.writePgmImage()
+			io.writeImage()
 		case ioCheckIdle:
 			io.channels.idle <- true
+		case ioCheckpoint:
+			io.writeCheckpoint()
+		case ioRecordFrame:
+			io.recordFrame()
+		case ioWriteRecording:
+			io.writeRecording()
 		}
 	}
+	// a recording is only left unfinished when k is pressed
+	if io.recording != nil {
+		io.recording.discard()
+	}
 }
@@ -0,0 +1,101 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// decodeLife106 reads a pattern in the Life 1.06 format, which lists the x and y coordinates of each alive cell, e.g.
+//
+//	#Life 1.06
+//	1 0
+//	2 1
+//	0 2
+//	1 2
+//	2 2
+//
+// The coordinates are positions in the world, so the pattern is anchored to the top left corner rather than centred.
+// Patterns from elsewhere are often centred on 0 0 instead; if any coordinate is negative the pattern is
+// moved so that its bounding box starts at 0 0, and it is centred like the other formats.
+func decodeLife106(r io.Reader, sizeOnly bool) (*pattern, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "#Life 1.06" {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("the first line should be #Life 1.06")
+	}
+
+	p := &pattern{anchored: true, sizeOnly: sizeOnly}
+	for line := 2; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var cell util.Cell
+		var rest string
+		if n, _ := fmt.Sscanf(text, "%d %d %s", &cell.X, &cell.Y, &rest); n != 2 {
+			return nil, fmt.Errorf("line %v should be two whole numbers, not %q", line, text)
+		}
+		p.add(cell)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	p.fitBounds()
+	return p, nil
+}
+
+// fitBounds sets the size of a pattern whose cells are given as positions in the world.
+// If any position is negative the pattern is moved so that its bounding box starts at 0 0, and it is no longer anchored.
+// Only the cells already added are moved, so any added later must be moved by the origin.
+func (p *pattern) fitBounds() {
+	if !p.bounds.alive {
+		return
+	}
+	origin := p.origin()
+	if origin != (util.Cell{}) {
+		p.anchored = false
+		for i := range p.cells {
+			p.cells[i].X -= origin.X
+			p.cells[i].Y -= origin.Y
+		}
+	}
+	if p.bounds.max.X-origin.X >= p.width {
+		p.width = p.bounds.max.X - origin.X + 1
+	}
+	if p.bounds.max.Y-origin.Y >= p.height {
+		p.height = p.bounds.max.Y - origin.Y + 1
+	}
+}
+
+// origin returns the position in the pattern file that fitBounds moves to 0 0, which is 0 0 itself unless a position is negative.
+func (p *pattern) origin() util.Cell {
+	var origin util.Cell
+	if p.bounds.min.X < 0 {
+		origin.X = p.bounds.min.X
+	}
+	if p.bounds.min.Y < 0 {
+		origin.Y = p.bounds.min.Y
+	}
+	return origin
+}
+
+// encodeLife106 writes the position of every alive cell in the Life 1.06 format, row by row.
+func encodeLife106(w io.Writer, world [][]uint8) error {
+	out := bufio.NewWriter(w)
+	out.WriteString("#Life 1.06\n")
+	for y, row := range world {
+		for x, cell := range row {
+			if cell == 255 {
+				fmt.Fprintf(out, "%v %v\n", x, y)
+			}
+		}
+	}
+	return out.Flush()
+}
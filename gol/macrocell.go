@@ -0,0 +1,302 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// mcNode is a node read from a macrocell file. Leaves are 8x8 squares at level 3 with one bit for each cell,
+// and every other node refers to its four quadrants by their position in the file, with 0 meaning empty.
+type mcNode struct {
+	level    uint
+	leaf     [8]uint8
+	children [4]int
+}
+
+// mcMaxLevel keeps the positions of cells inside an int.
+const mcMaxLevel = 62
+
+// mcMaxArea is the most cells a macrocell pattern may cover, e.g. 8192x8192. A few lines of a macrocell file
+// can describe a world far bigger than fits in memory, and every cell is expanded into the world that is simulated.
+const mcMaxArea = 1 << 26
+
+// mcSizePrefix starts the comment line that gives the size of the world a macrocell file was written from.
+const mcSizePrefix = "#C gol size:"
+
+// decodeMacrocell reads a pattern in the Golly macrocell format, which stores the world as a quadtree
+// with each distinct square written only once, e.g.
+//
+//	[M2] (golly 4.2)
+//	#R B3/S23
+//	$$..*$...*$.***$
+//	4 0 0 0 1
+//
+// The last node is the root, and it is centred on 0 0. Like Life 1.06, patterns with no cells at negative
+// positions are anchored to the top left corner and any others are centred.
+// The size comes from the bounds of each node, so if only the size is wanted the cells are never expanded,
+// and patterns covering more than mcMaxArea cells are refused before they are. Files written by encodeMacrocell
+// also give the size of their world in a #C gol size: line, as the bounds alone would lose any empty rows and columns.
+func decodeMacrocell(r io.Reader, sizeOnly bool) (*pattern, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "[M2]") {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("the first line should start with [M2]")
+	}
+
+	p := &pattern{anchored: true, sizeOnly: sizeOnly}
+	// nodes[0] stands for the empty squares
+	nodes := []mcNode{{}}
+	for line := 2; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			if strings.HasPrefix(text, "#R ") {
+				rule, err := parseRuleHeader(strings.TrimSpace(text[3:]))
+				if err != nil {
+					return nil, err
+				}
+				p.rule = rule
+			}
+			if strings.HasPrefix(text, mcSizePrefix) {
+				size := strings.TrimSpace(strings.TrimPrefix(text, mcSizePrefix))
+				var rest string
+				if n, _ := fmt.Sscanf(size, "%dx%d%s", &p.width, &p.height, &rest); n != 2 || p.width < 0 || p.height < 0 {
+					return nil, fmt.Errorf("line %v: the size should look like 64x64, not %q", line, size)
+				}
+			}
+			continue
+		}
+		n, err := parseMcNode(text, nodes)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		nodes = append(nodes, n)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(nodes) == 1 {
+		return nil, fmt.Errorf("the file has no nodes")
+	}
+
+	root := len(nodes) - 1
+	half := -(1 << (nodes[root].level - 1))
+	if b := mcNodeBounds(nodes)[root]; b.alive {
+		p.bounds.grow(util.Cell{X: half + b.min.X, Y: half + b.min.Y})
+		p.bounds.grow(util.Cell{X: half + b.max.X, Y: half + b.max.Y})
+	}
+	p.fitBounds()
+	if p.width > 0 && p.height > 0 && p.width > mcMaxArea/p.height {
+		return nil, fmt.Errorf("the %vx%v pattern covers more than the %v cells allowed", p.width, p.height, mcMaxArea)
+	}
+	if !p.sizeOnly {
+		origin := p.origin()
+		p.cells = expandMcNode(nodes, root, half-origin.X, half-origin.Y, nil)
+	}
+	return p, nil
+}
+
+// mcNodeBounds finds the bounds of the alive cells in every node, relative to its top left corner.
+// Quadrants always come before the nodes made of them, so each node is looked at once however many times it is used.
+func mcNodeBounds(nodes []mcNode) []bounds {
+	nodeBounds := make([]bounds, len(nodes))
+	for i, n := range nodes[1:] {
+		b := &nodeBounds[i+1]
+		if n.level == 3 {
+			for dy, row := range n.leaf {
+				for dx := 0; dx < 8; dx++ {
+					if row&(1<<dx) != 0 {
+						b.grow(util.Cell{X: dx, Y: dy})
+					}
+				}
+			}
+			continue
+		}
+		half := 1 << (n.level - 1)
+		for q, child := range n.children {
+			if c := nodeBounds[child]; c.alive {
+				x, y := q%2*half, q/2*half
+				b.grow(util.Cell{X: x + c.min.X, Y: y + c.min.Y})
+				b.grow(util.Cell{X: x + c.max.X, Y: y + c.max.Y})
+			}
+		}
+	}
+	return nodeBounds
+}
+
+// parseMcNode reads either a leaf, made of the rows of . and * separated by $, or the level and quadrants of a node.
+func parseMcNode(text string, nodes []mcNode) (mcNode, error) {
+	if c := text[0]; c == '.' || c == '*' || c == '$' {
+		n := mcNode{level: 3}
+		x, y := 0, 0
+		for _, c := range text {
+			switch c {
+			case '.':
+				x++
+			case '*':
+				if x >= 8 || y >= 8 {
+					return n, fmt.Errorf("the leaf %q is bigger than 8x8", text)
+				}
+				n.leaf[y] |= 1 << x
+				x++
+			case '$':
+				x = 0
+				y++
+			default:
+				return n, fmt.Errorf("unexpected %q in the leaf %q", c, text)
+			}
+		}
+		return n, nil
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) != 5 {
+		return mcNode{}, fmt.Errorf("a node should be its level followed by four quadrants, not %q", text)
+	}
+	level, err := strconv.Atoi(fields[0])
+	if err != nil || level < 4 || level > mcMaxLevel {
+		return mcNode{}, fmt.Errorf("the level of a node should be between 4 and %v, not %q", mcMaxLevel, fields[0])
+	}
+	n := mcNode{level: uint(level)}
+	for i, field := range fields[1:] {
+		child, err := strconv.Atoi(field)
+		if err != nil || child < 0 || child >= len(nodes) {
+			return n, fmt.Errorf("the quadrant %q should be the number of an earlier node", field)
+		}
+		if child != 0 && nodes[child].level != n.level-1 {
+			return n, fmt.Errorf("the quadrant %v is at level %v rather than %v", child, nodes[child].level, n.level-1)
+		}
+		n.children[i] = child
+	}
+	return n, nil
+}
+
+// expandMcNode appends the position of every alive cell in a node whose top left corner is at x, y.
+func expandMcNode(nodes []mcNode, i, x, y int, cells []util.Cell) []util.Cell {
+	if i == 0 {
+		return cells
+	}
+	n := nodes[i]
+	if n.level == 3 {
+		for dy, row := range n.leaf {
+			for dx := 0; dx < 8; dx++ {
+				if row&(1<<dx) != 0 {
+					cells = append(cells, util.Cell{X: x + dx, Y: y + dy})
+				}
+			}
+		}
+		return cells
+	}
+	half := 1 << (n.level - 1)
+	cells = expandMcNode(nodes, n.children[0], x, y, cells)
+	cells = expandMcNode(nodes, n.children[1], x+half, y, cells)
+	cells = expandMcNode(nodes, n.children[2], x, y+half, cells)
+	return expandMcNode(nodes, n.children[3], x+half, y+half, cells)
+}
+
+// mcEncoder numbers the distinct squares of a world in the order they are written.
+type mcEncoder struct {
+	out    *bufio.Writer
+	world  [][]uint8
+	leaves map[[8]uint8]int
+	nodes  map[mcNode]int
+	count  int
+}
+
+// encodeMacrocell writes the world in the macrocell format. The world is put in the south east quadrant
+// of the root so that its top left corner is at 0 0, and it is read back to the same place and size.
+func encodeMacrocell(w io.Writer, world [][]uint8, rule Rule) error {
+	e := &mcEncoder{
+		out:    bufio.NewWriter(w),
+		world:  world,
+		leaves: make(map[[8]uint8]int),
+		nodes:  make(map[mcNode]int),
+	}
+	size := len(world)
+	if size > 0 && len(world[0]) > size {
+		size = len(world[0])
+	}
+	level := uint(3)
+	for 1<<level < size {
+		level++
+	}
+
+	e.out.WriteString("[M2] (gol)\n")
+	fmt.Fprintf(e.out, "#R %v\n", rule)
+	width := 0
+	if len(world) > 0 {
+		width = len(world[0])
+	}
+	fmt.Fprintf(e.out, "%v %vx%v\n", mcSizePrefix, width, len(world))
+	// the root is always written, even for an empty world
+	e.write(mcNode{level: level + 1, children: [4]int{0, 0, 0, e.encode(0, 0, level)}})
+	return e.out.Flush()
+}
+
+// encode writes every distinct square inside the node at x, y that has not been written yet, followed by the node itself.
+func (e *mcEncoder) encode(x, y int, level uint) int {
+	if level == 3 {
+		var leaf [8]uint8
+		empty := true
+		for dy := 0; dy < 8; dy++ {
+			for dx := 0; dx < 8; dx++ {
+				if y+dy < len(e.world) && x+dx < len(e.world[y+dy]) && e.world[y+dy][x+dx] == 255 {
+					leaf[dy] |= 1 << dx
+					empty = false
+				}
+			}
+		}
+		if empty {
+			return 0
+		}
+		if i, ok := e.leaves[leaf]; ok {
+			return i
+		}
+		e.count++
+		e.leaves[leaf] = e.count
+		for _, row := range leaf {
+			for dx := 0; row>>dx != 0; dx++ {
+				if row&(1<<dx) != 0 {
+					e.out.WriteByte('*')
+				} else {
+					e.out.WriteByte('.')
+				}
+			}
+			e.out.WriteByte('$')
+		}
+		e.out.WriteByte('\n')
+		return e.count
+	}
+
+	half := 1 << (level - 1)
+	n := mcNode{level: level, children: [4]int{
+		e.encode(x, y, level-1),
+		e.encode(x+half, y, level-1),
+		e.encode(x, y+half, level-1),
+		e.encode(x+half, y+half, level-1),
+	}}
+	if n.children == [4]int{} {
+		return 0
+	}
+	return e.write(n)
+}
+
+// write writes a node made of quadrants that have already been written, unless an identical one has been.
+func (e *mcEncoder) write(n mcNode) int {
+	if i, ok := e.nodes[n]; ok {
+		return i
+	}
+	e.count++
+	e.nodes[n] = e.count
+	fmt.Fprintf(e.out, "%v %v %v %v %v\n", n.level, n.children[0], n.children[1], n.children[2], n.children[3])
+	return e.count
+}
@@ -0,0 +1,232 @@
+package gol
+
+import (
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// packedStrip stores 64 cells in each word, with cell x of a row held in bit x%64 of word x/64.
+// Like byteStrip, rows 0 and height+1 hold the halo rows received from the neighbouring workers.
+// The cells beyond the left and right edges of the world are kept as single bits in westPad and
+// eastPad, which are shifted in while calculating the neighbours of the first and last words.
+type packedStrip struct {
+	y1            int
+	width, height int
+	worldHeight   int
+	turn          int
+	words         int
+	// lastMask has a bit set for every cell that is inside the last word of a row
+	lastMask         uint64
+	rule             Rule
+	topology         Topology
+	columns          *edgeColumns
+	westPad, eastPad []uint64
+	current, next    [][]uint64
+}
+
+func newPackedStrip(p Params, world [][]uint8, y1, y2 int, columns *edgeColumns) *packedStrip {
+	width := len(world[0])
+	s := &packedStrip{
+		y1:          y1,
+		width:       width,
+		height:      (y2 - y1) + 1,
+		worldHeight: len(world),
+		words:       (width + 63) / 64,
+		lastMask:    ^uint64(0) >> uint(63-(width-1)%64),
+		rule:        p.Rule.orDefault(),
+		topology:    p.Topology,
+		columns:     columns,
+	}
+	s.westPad = make([]uint64, s.height+2)
+	s.eastPad = make([]uint64, s.height+2)
+	s.current = makePackedRows(s.height+2, s.words)
+	s.next = makePackedRows(s.height+2, s.words)
+	for j := 0; j < s.height; j++ {
+		packRow(world[y1+j], s.current[j+1])
+	}
+	return s
+}
+
+func makePackedRows(height, words int) [][]uint64 {
+	rows := make([][]uint64, height)
+	for i := range rows {
+		rows[i] = make([]uint64, words)
+	}
+	return rows
+}
+
+// packRow sets the bit of every alive cell in a row of 0 or 255 bytes.
+func packRow(row []uint8, packed []uint64) {
+	for i := range packed {
+		packed[i] = 0
+	}
+	for x, cell := range row {
+		if cell == 255 {
+			packed[x/64] |= 1 << uint(x%64)
+		}
+	}
+}
+
+// unpackRow is the inverse of packRow.
+func unpackRow(packed []uint64, row []uint8) {
+	for x := range row {
+		row[x] = uint8(packed[x/64]>>uint(x%64)&1) * 255
+	}
+}
+
+func (s *packedStrip) edges() (top, bottom halo) {
+	return s.current[1], s.current[s.height]
+}
+
+func (s *packedStrip) setHalo(above, below halo) {
+	top, bottom := s.current[0], s.current[s.height+1]
+	copy(top, above.([]uint64))
+	copy(bottom, below.([]uint64))
+	if s.y1 == 0 {
+		s.beyondEdge(top, s.current[1])
+	}
+	if s.y1+s.height == s.worldHeight {
+		s.beyondEdge(bottom, s.current[s.height])
+	}
+	for j := range s.current {
+		s.westPad[j], s.eastPad[j] = s.sides(j)
+	}
+}
+
+// beyondEdge replaces a halo row received from the other side of the top or bottom edge of the world.
+// edge is the row of the strip on this side of the edge.
+func (s *packedStrip) beyondEdge(halo, edge []uint64) {
+	switch {
+	case s.topology == Plane:
+		for k := range halo {
+			halo[k] = 0
+		}
+	case s.topology == Reflect:
+		copy(halo, edge)
+	case s.topology.flipsVertically():
+		reversed := make([]uint64, s.words)
+		for x := 0; x < s.width; x++ {
+			reversed[(s.width-1-x)/64] |= s.bit(halo, x) << uint((s.width-1-x)%64)
+		}
+		copy(halo, reversed)
+	}
+}
+
+// sides returns the cells beyond the left and right edges of the world for row j of the buffer.
+func (s *packedStrip) sides(j int) (west, east uint64) {
+	row := s.current[j]
+	switch s.topology {
+	case Plane:
+		return 0, 0
+	case Reflect:
+		return s.bit(row, 0), s.bit(row, s.width-1)
+	case CrossSurface:
+		left, right := s.columns.sides(s.turn, s.y1+j-1)
+		return uint64(left), uint64(right)
+	default:
+		return s.bit(row, s.width-1), s.bit(row, 0)
+	}
+}
+
+// bit returns the cell at x in a packed row.
+func (s *packedStrip) bit(row []uint64, x int) uint64 {
+	return row[x/64] >> uint(x%64) & 1
+}
+
+// west returns word k of row j shifted so that each cell lines up with its right hand neighbour,
+// i.e. each bit holds the cell to the west of it.
+func (s *packedStrip) west(j, k int) uint64 {
+	row := s.current[j]
+	if k == 0 {
+		return row[0]<<1 | s.westPad[j]
+	}
+	return row[k]<<1 | row[k-1]>>63
+}
+
+// east returns word k of row j where each bit holds the cell to the east of it.
+func (s *packedStrip) east(j, k int) uint64 {
+	row := s.current[j]
+	if k == s.words-1 {
+		return row[k]>>1 | s.eastPad[j]<<uint((s.width-1)%64)
+	}
+	return row[k]>>1 | row[k+1]<<63
+}
+
+func halfAdd(a, b uint64) (sum, carry uint64) {
+	return a ^ b, a & b
+}
+
+func fullAdd(a, b, c uint64) (sum, carry uint64) {
+	return a ^ b ^ c, (a & b) | (c & (a ^ b))
+}
+
+// match returns the word unchanged if the bit of the neighbour count it represents should be set, otherwise it inverts it.
+func match(word uint64, set int) uint64 {
+	if set != 0 {
+		return word
+	}
+	return ^word
+}
+
+// step calculates 64 cells at a time by adding up the eight neighbour words with bitwise adders,
+// leaving the number of alive neighbours of every cell spread over four words.
+func (s *packedStrip) step() ([]util.Cell, int) {
+	var flipped []util.Cell
+	alive := 0
+	for j := 1; j <= s.height; j++ {
+		above, row, below := s.current[j-1], s.current[j], s.current[j+1]
+		newRow := s.next[j]
+		for k := 0; k < s.words; k++ {
+			s0, c0 := fullAdd(s.west(j-1, k), above[k], s.east(j-1, k))
+			s1, c1 := fullAdd(s.west(j+1, k), below[k], s.east(j+1, k))
+			s2, c2 := halfAdd(s.west(j, k), s.east(j, k))
+
+			ones, c3 := fullAdd(s0, s1, s2)
+			t0, t1 := fullAdd(c0, c1, c2)
+			twos, t2 := halfAdd(t0, c3)
+			fours, eights := halfAdd(t1, t2)
+
+			var born, survives uint64
+			for n := 0; n <= 8; n++ {
+				if (s.rule.Birth|s.rule.Survival)&(1<<uint(n)) == 0 {
+					continue
+				}
+				// cells with exactly n alive neighbours
+				count := match(ones, n&1) & match(twos, n&2) & match(fours, n&4) & match(eights, n&8)
+				if s.rule.Birth&(1<<uint(n)) != 0 {
+					born |= count
+				}
+				if s.rule.Survival&(1<<uint(n)) != 0 {
+					survives |= count
+				}
+			}
+			cells := (born &^ row[k]) | (survives & row[k])
+			if k == s.words-1 {
+				cells &= s.lastMask
+			}
+
+			alive += bits.OnesCount64(cells)
+			for diff := cells ^ row[k]; diff != 0; diff &= diff - 1 {
+				x := k*64 + bits.TrailingZeros64(diff)
+				flipped = append(flipped, util.Cell{X: x, Y: s.y1 + j - 1})
+			}
+			newRow[k] = cells
+		}
+		if s.columns != nil {
+			s.columns.set(s.turn+1, s.y1+j-1, uint8(s.bit(newRow, 0)), uint8(s.bit(newRow, s.width-1)))
+		}
+	}
+	s.current, s.next = s.next, s.current
+	s.turn++
+	return flipped, alive
+}
+
+func (s *packedStrip) rows() [][]uint8 {
+	rows := make([][]uint8, s.height)
+	for j := range rows {
+		rows[j] = make([]uint8, s.width)
+		unpackRow(s.current[j+1], rows[j])
+	}
+	return rows
+}
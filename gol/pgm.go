@@ -0,0 +1,260 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// encodePgm writes the world as a binary pgm image.
+func encodePgm(w io.Writer, world [][]uint8) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "P5\n%v %v\n255\n", len(world[0]), len(world))
+	for _, row := range world {
+		out.Write(row)
+	}
+	return out.Flush()
+}
+
+// encodePbm writes the world as a binary (P4) pbm image, or a plain (P1) one, with alive cells as black pixels.
+func encodePbm(w io.Writer, world [][]uint8, plain bool) error {
+	out := bufio.NewWriter(w)
+	if plain {
+		fmt.Fprintf(out, "P1\n%v %v\n", len(world[0]), len(world))
+	} else {
+		fmt.Fprintf(out, "P4\n%v %v\n", len(world[0]), len(world))
+	}
+	packed := make([]byte, (len(world[0])+7)/8)
+	for _, row := range world {
+		if plain {
+			// lines of plain pbm images should be at most 70 characters long
+			for x, cell := range row {
+				if cell == 255 {
+					out.WriteByte('1')
+				} else {
+					out.WriteByte('0')
+				}
+				if (x+1)%70 == 0 || x == len(row)-1 {
+					out.WriteByte('\n')
+				}
+			}
+			continue
+		}
+		for i := range packed {
+			packed[i] = 0
+		}
+		for x, cell := range row {
+			if cell == 255 {
+				packed[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		out.Write(packed)
+	}
+	return out.Flush()
+}
+
+// pgmDecoder reads the binary (P5) and plain (P2) variants of the pgm format one byte at a time,
+// so that comments, any whitespace between header fields and any byte values in the raster are handled.
+// It also reads the binary (P4) and plain (P1) variants of the pbm format, which have one bit for each pixel.
+type pgmDecoder struct {
+	r      *bufio.Reader
+	format string
+	width  int
+	height int
+	maxval int
+}
+
+func newPgmDecoder(r io.Reader) *pgmDecoder {
+	return &pgmDecoder{r: bufio.NewReader(r)}
+}
+
+// eof turns an end of file into an error describing what was being read.
+func eof(err error, what string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("unexpected end of file while reading %v", what)
+	}
+	return err
+}
+
+// skipSpace skips whitespace and comments, which run from a # to the end of the line.
+func (d *pgmDecoder) skipSpace(what string) error {
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return eof(err, what)
+		}
+		switch {
+		case b == '#':
+			if _, err := d.r.ReadString('\n'); err != nil {
+				return eof(err, what)
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f':
+		default:
+			return d.r.UnreadByte()
+		}
+	}
+}
+
+// readInt reads a decimal number after any whitespace and comments.
+func (d *pgmDecoder) readInt(what string) (int, error) {
+	if err := d.skipSpace(what); err != nil {
+		return 0, err
+	}
+	n, digits := 0, 0
+	for {
+		b, err := d.r.ReadByte()
+		if err == io.EOF && digits > 0 {
+			return n, nil
+		}
+		if err != nil {
+			return 0, eof(err, what)
+		}
+		if b < '0' || b > '9' {
+			if digits == 0 {
+				return 0, fmt.Errorf("expected a number for %v, found %q", what, b)
+			}
+			return n, d.r.UnreadByte()
+		}
+		n = n*10 + int(b-'0')
+		digits++
+		if n > 1<<30 {
+			return 0, fmt.Errorf("%v is too large", what)
+		}
+	}
+}
+
+// readHeader reads the format, size and maximum value of the image.
+func (d *pgmDecoder) readHeader() error {
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(d.r, magic); err != nil {
+		return eof(err, "the format")
+	}
+	d.format = string(magic)
+	switch d.format {
+	case "P5", "P2", "P4", "P1":
+	default:
+		return fmt.Errorf("not a pgm or pbm file, the format is %q rather than P5, P2, P4 or P1", d.format)
+	}
+
+	var err error
+	if d.width, err = d.readInt("the width"); err != nil {
+		return err
+	}
+	if d.height, err = d.readInt("the height"); err != nil {
+		return err
+	}
+	// pbm files have no maximum value, every pixel is either 0 or 1
+	d.maxval = 1
+	if d.format == "P5" || d.format == "P2" {
+		if d.maxval, err = d.readInt("the maximum value"); err != nil {
+			return err
+		}
+	}
+	if d.width == 0 || d.height == 0 {
+		return fmt.Errorf("the image is empty (%vx%v)", d.width, d.height)
+	}
+	if d.maxval == 0 || d.maxval > 65535 {
+		return fmt.Errorf("the maximum value %v is not between 1 and 65535", d.maxval)
+	}
+
+	if d.format == "P5" || d.format == "P4" {
+		// exactly one whitespace character separates the header from the raster
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return eof(err, "the raster")
+		}
+		if b != ' ' && b != '\t' && b != '\n' && b != '\r' {
+			return fmt.Errorf("expected whitespace before the raster, found %q", b)
+		}
+	}
+	return nil
+}
+
+// readValue reads the next pixel of the raster.
+func (d *pgmDecoder) readValue() (int, error) {
+	if d.format == "P2" {
+		return d.readInt("the raster")
+	}
+	hi, err := d.r.ReadByte()
+	if err != nil {
+		return 0, eof(err, "the raster")
+	}
+	if d.maxval < 256 {
+		return int(hi), nil
+	}
+	// values above 255 take two bytes, most significant first
+	lo, err := d.r.ReadByte()
+	if err != nil {
+		return 0, eof(err, "the raster")
+	}
+	return int(hi)<<8 | int(lo), nil
+}
+
+// readBit reads the next pixel of a plain pbm raster, where the digits need not be separated by whitespace.
+func (d *pgmDecoder) readBit() (int, error) {
+	if err := d.skipSpace("the raster"); err != nil {
+		return 0, err
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, eof(err, "the raster")
+	}
+	if b != '0' && b != '1' {
+		return 0, fmt.Errorf("expected 0 or 1 in the raster, found %q", b)
+	}
+	return int(b - '0'), nil
+}
+
+// readBits reads a pbm raster, where 1 is black. Black pixels are alive cells as in other Life software,
+// so a pbm image looks like the inverse of the pgm images, which show alive cells as white.
+// Each row of a binary raster is packed into bytes, most significant bit first, with the last byte padded.
+func (d *pgmDecoder) readBits() ([]uint8, error) {
+	cells := make([]uint8, d.width*d.height)
+	row := make([]byte, (d.width+7)/8)
+	for y := 0; y < d.height; y++ {
+		if d.format == "P4" {
+			if _, err := io.ReadFull(d.r, row); err != nil {
+				return nil, eof(err, "the raster")
+			}
+		}
+		for x := 0; x < d.width; x++ {
+			bit := int(row[x/8]>>(7-x%8)) & 1
+			if d.format == "P1" {
+				var err error
+				if bit, err = d.readBit(); err != nil {
+					return nil, err
+				}
+			}
+			if bit == 1 {
+				cells[y*d.width+x] = 255
+			}
+		}
+	}
+	return cells, nil
+}
+
+// readCells reads the raster, turning every pixel at least threshold of the maximum value into an
+// alive cell (255) and the rest into dead cells (0). A threshold of 0 means half of the maximum value.
+// The threshold is not used for pbm images, whose pixels are alive if they are black.
+func (d *pgmDecoder) readCells(threshold float64) ([]uint8, error) {
+	if d.format == "P4" || d.format == "P1" {
+		return d.readBits()
+	}
+	if threshold == 0 {
+		threshold = 0.5
+	}
+	cells := make([]uint8, d.width*d.height)
+	for i := range cells {
+		value, err := d.readValue()
+		if err != nil {
+			return nil, err
+		}
+		if value > d.maxval {
+			return nil, fmt.Errorf("pixel %v at (%v, %v) is above the maximum value %v", value, i%d.width, i/d.width, d.maxval)
+		}
+		if float64(value) >= threshold*float64(d.maxval) {
+			cells[i] = 255
+		}
+	}
+	return cells, nil
+}
@@ -0,0 +1,149 @@
+package gol
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// palettes give the colours of dead and alive cells in png images.
+// The age palette colours alive cells by how many turns they have been alive for instead.
+var palettes = map[string][2]color.RGBA{
+	"grey":  {{0, 0, 0, 255}, {255, 255, 255, 255}},
+	"paper": {{255, 255, 255, 255}, {0, 0, 0, 255}},
+	"green": {{16, 24, 16, 255}, {64, 224, 96, 255}},
+	"age":   {{0, 0, 0, 255}, {255, 255, 160, 255}},
+}
+
+// oldAge is the age at which cells reach the last colour of the age palette.
+const oldAge = 64
+
+// oldColour is the colour of cells at least oldAge turns old in the age palette.
+var oldColour = color.RGBA{160, 32, 64, 255}
+
+// CheckPalette returns an error if there is no png palette with the given name.
+func CheckPalette(name string) error {
+	if _, ok := palettes[name]; ok || name == "" {
+		return nil
+	}
+	return fmt.Errorf("unknown palette %q", name)
+}
+
+// paletteName returns the palette that png images are drawn with.
+func paletteName(p Params) string {
+	if p.Palette == "" {
+		return "grey"
+	}
+	return p.Palette
+}
+
+// needsAges returns whether the ages of the cells are needed to write images.
+func needsAges(p Params) bool {
+	return outputFormat(p) == "png" && paletteName(p) == "age"
+}
+
+// encodePng writes the world as a png image with each cell drawn as a square scale pixels wide.
+// ages is only used by the age palette, and gives the number of turns each alive cell has been alive for.
+func encodePng(w io.Writer, world [][]uint8, ages [][]int, scale int, palette string) error {
+	if scale <= 0 {
+		scale = 1
+	}
+	colours := palettes[palette]
+	height := len(world)
+	width := 0
+	if height > 0 {
+		width = len(world[0])
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width*scale, height*scale))
+	for y, row := range world {
+		for x, cell := range row {
+			c := colours[0]
+			if cell == 255 {
+				c = colours[1]
+				if palette == "age" && ages != nil {
+					c = ageColour(ages[y][x])
+				}
+			}
+			for j := 0; j < scale; j++ {
+				for i := 0; i < scale; i++ {
+					img.SetRGBA(x*scale+i, y*scale+j, c)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// ageColour fades from the alive colour of the age palette for newborn cells to oldColour for old ones.
+func ageColour(age int) color.RGBA {
+	if age > oldAge {
+		age = oldAge
+	}
+	young := palettes["age"][1]
+	mix := func(a, b uint8) uint8 {
+		return uint8((int(a)*(oldAge-age) + int(b)*age) / oldAge)
+	}
+	return color.RGBA{mix(young.R, oldColour.R), mix(young.G, oldColour.G), mix(young.B, oldColour.B), 255}
+}
+
+// ageTracker remembers the turn at which each alive cell was born, using the cells flipped by each advance.
+// Cells flipped by stepping backwards are treated as being born or dying at the turn stepped back to.
+type ageTracker struct {
+	// born is -1 for dead cells
+	born [][]int
+}
+
+// newAgeTracker returns nil unless the ages of cells are needed, so that they are only tracked when used.
+// Cells alive at the start are treated as being born at that turn.
+func newAgeTracker(p Params, world [][]uint8, turn int) *ageTracker {
+	if !needsAges(p) {
+		return nil
+	}
+	a := &ageTracker{born: make([][]int, len(world))}
+	for y, row := range world {
+		a.born[y] = make([]int, len(row))
+		for x, cell := range row {
+			a.born[y][x] = -1
+			if cell == 255 {
+				a.born[y][x] = turn
+			}
+		}
+	}
+	return a
+}
+
+// update flips the cells that changed in the turn given.
+func (a *ageTracker) update(flipped []util.Cell, turn int) {
+	if a == nil {
+		return
+	}
+	for _, cell := range flipped {
+		if a.born[cell.Y][cell.X] < 0 {
+			a.born[cell.Y][cell.X] = turn
+		} else {
+			a.born[cell.Y][cell.X] = -1
+		}
+	}
+}
+
+// ages returns how many turns each cell has been alive for at the given turn, or nil if ages are not tracked.
+func (a *ageTracker) ages(turn int) [][]int {
+	if a == nil {
+		return nil
+	}
+	ages := make([][]int, len(a.born))
+	for y, row := range a.born {
+		ages[y] = make([]int, len(row))
+		for x, born := range row {
+			if born >= 0 {
+				ages[y][x] = turn - born
+			}
+		}
+	}
+	return ages
+}
@@ -0,0 +1,380 @@
+package gol
+
+import (
+	"fmt"
+	"net/rpc"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// The distributed mode splits the program into three kinds of process, which talk to each other over TCP with net/rpc:
+//
+//	the controller is gol.Run with Params.Broker set. It reads and writes images and handles key presses as usual,
+//	  but uploads the world to the broker and only receives back the cells that changed.
+//	  Pressing q detaches the controller, leaving the broker to carry on by itself until a controller attaches again.
+//	the broker divides the world between the remote workers and keeps them all on the same turn, see ServeBroker.
+//	each remote worker keeps a strip of the world for the whole run and calculates its next state every turn,
+//	  exchanging its top and bottom rows directly with the workers above and below it, see ServeWorker.
+//	  Workers can join and leave a running broker, which divides the world between them again at the next turn.
+//
+// The requests and responses below are the messages sent between them. Starting or attaching to a simulation
+// begins a new session, and the requests of any earlier session are refused from then on, so only the last
+// controller to attach can process turns.
+
+const (
+	brokerStart   = "Broker.Start"
+	brokerAttach  = "Broker.Attach"
+	brokerStatus  = "Broker.Status"
+	brokerAdvance = "Broker.Advance"
+	brokerDetach  = "Broker.Detach"
+	brokerStop    = "Broker.Stop"
+
+	brokerRegister   = "Broker.Register"
+	brokerDeregister = "Broker.Deregister"
+
+	workerLoadRPC    = "RemoteWorker.Load"
+	workerStepRPC    = "RemoteWorker.Step"
+	workerHaloRPC    = "RemoteWorker.Halo"
+	workerChangesRPC = "RemoteWorker.Changes"
+	workerRowsRPC    = "RemoteWorker.Rows"
+	workerPingRPC    = "RemoteWorker.Ping"
+	workerUnloadRPC  = "RemoteWorker.Unload"
+)
+
+// workerTimeout is how long the broker and the remote workers wait for a worker during a turn before deciding that it has failed.
+// pingTimeout is how long the broker waits for a worker to answer a ping, either once a call to the workers has failed
+// or every heartbeatInterval between turns.
+const (
+	workerTimeout     = 5 * time.Second
+	pingTimeout       = time.Second
+	heartbeatInterval = time.Second
+)
+
+// StartRequest uploads the world at Turn from the controller to the broker, along with how it should be processed.
+// Turns is the last turn the broker processes by itself once the controller detaches.
+type StartRequest struct {
+	World       [][]uint8
+	Turn, Turns int
+	Rule        Rule
+	Topology    Topology
+	Engine      Engine
+}
+
+// StartResponse gives the session of the controller and the number of remote workers that the turns are divided between.
+type StartResponse struct {
+	Session int
+	Workers int
+}
+
+// AttachRequest takes over the simulation running on the broker. If Turns is not zero it replaces the last turn
+// the broker processes by itself.
+type AttachRequest struct {
+	Turns int
+}
+
+// AttachResponse gives the session of the controller and the current world and turn of the simulation,
+// along with how it is being processed.
+type AttachResponse struct {
+	Session     int
+	World       [][]uint8
+	Turn, Turns int
+	Rule        Rule
+	Topology    Topology
+	Engine      Engine
+}
+
+// StatusRequest asks about the simulation running on the broker without attaching to it.
+type StatusRequest struct{}
+
+// StatusResponse gives the size of the world and the current turn of the simulation, along with how it is being
+// processed and whether a controller is attached.
+type StatusResponse struct {
+	Width, Height int
+	Turn, Turns   int
+	Rule          Rule
+	Topology      Topology
+	Engine        Engine
+	Attached      bool
+}
+
+// AdvanceRequest asks the broker to process up to Turns turns.
+type AdvanceRequest struct {
+	Session int
+	Turns   int
+}
+
+// AdvanceResponse gives the number of turns processed, the cells that changed over all of them
+// and the number of alive cells afterwards, along with any recoveries from failed workers since the last Advance.
+type AdvanceResponse struct {
+	Turns      int
+	Flipped    []util.Cell
+	Alive      int
+	Recoveries []Recovery
+}
+
+// Recovery describes the remote workers that failed and the turn that the rest of the workers carried on from.
+type Recovery struct {
+	Turn    int
+	Failed  []string
+	Workers int
+}
+
+// DetachRequest leaves the broker to carry on by itself.
+type DetachRequest struct {
+	Session int
+}
+
+// DetachResponse is empty.
+type DetachResponse struct{}
+
+// StopRequest ends the simulation running on the broker.
+type StopRequest struct {
+	Session int
+}
+
+// StopResponse is empty.
+type StopResponse struct{}
+
+// RegisterRequest adds the remote worker at Address to the broker.
+type RegisterRequest struct {
+	Address string
+}
+
+// RegisterResponse gives the number of workers the broker has now.
+type RegisterResponse struct {
+	Workers int
+}
+
+// DeregisterRequest removes the remote worker at Address from the broker.
+type DeregisterRequest struct {
+	Address string
+}
+
+// DeregisterResponse is empty.
+type DeregisterResponse struct{}
+
+// LoadRequest gives a remote worker rows Y1 onwards of a world Width by Height to keep for the rest of the run,
+// along with the addresses of the workers with the strips above and below it.
+// Generation counts the times the broker has loaded strips, so rows sent between the workers for earlier
+// strips can be told apart.
+type LoadRequest struct {
+	Generation    int
+	Rows          [][]uint8
+	Y1            int
+	Width, Height int
+	Rule          Rule
+	Topology      Topology
+	Engine        Engine
+	Above, Below  string
+}
+
+// LoadResponse is empty.
+type LoadResponse struct{}
+
+// StepRequest asks a remote worker to calculate the next state of its strip. The cross-surface topology
+// needs the first and last columns of the whole world as well, which are gathered by the broker.
+type StepRequest struct {
+	First, Last []uint8
+}
+
+// StepResponse gives the number of alive cells in the strip after a step, along with the first and last
+// cells of each of its rows for the cross-surface topology.
+type StepResponse struct {
+	Alive       int
+	First, Last []uint8
+}
+
+// HaloRequest sends the top or bottom row of a strip directly to the worker with the neighbouring strip,
+// from the given turn since the strips were loaded. Only one of Bytes and Words is set, depending on the engine.
+type HaloRequest struct {
+	Generation, Turn int
+	FromBelow        bool
+	Bytes            []uint8
+	Words            []uint64
+}
+
+// HaloResponse is empty.
+type HaloResponse struct{}
+
+// ChangesRequest asks a remote worker for the cells of its strip that have changed since it last asked.
+type ChangesRequest struct{}
+
+// ChangesResponse gives the cells that have changed.
+type ChangesResponse struct {
+	Flipped []util.Cell
+}
+
+// RowsRequest asks a remote worker for its strip.
+type RowsRequest struct{}
+
+// RowsResponse gives the rows of a strip.
+type RowsResponse struct {
+	Rows [][]uint8
+}
+
+// PingRequest checks that a remote worker is still running.
+type PingRequest struct{}
+
+// PingResponse is empty.
+type PingResponse struct{}
+
+// UnloadRequest asks a remote worker to drop its strip once the simulation is over.
+type UnloadRequest struct{}
+
+// UnloadResponse is empty.
+type UnloadResponse struct{}
+
+// remoteSimulation is used by the controller in place of the local workers when a broker is given.
+// It keeps its own copy of the world, kept up to date with the cells flipped by the broker, so the world
+// can be written without asking the broker for it and is still there if the broker is lost.
+type remoteSimulation struct {
+	client     *rpc.Client
+	session    int
+	current    [][]uint8
+	alive      int
+	failure    error
+	recoveries []Recovery
+}
+
+// newRemoteSimulation connects to the broker in p and uploads the world to it, unless there is already a session
+// from attaching to the simulation on the broker, in which case the world must be the one received then.
+func newRemoteSimulation(p Params, world [][]uint8, turn, session int) (*remoteSimulation, error) {
+	client, err := rpc.Dial("tcp", p.Broker)
+	if err != nil {
+		return nil, err
+	}
+	r := &remoteSimulation{client: client, session: session, current: copyWorld(world)}
+	if r.session == 0 {
+		req := StartRequest{World: world, Turn: turn, Turns: p.Turns, Rule: p.Rule, Topology: p.Topology, Engine: p.Engine}
+		var res StartResponse
+		if err := client.Call(brokerStart, req, &res); err != nil {
+			client.Close()
+			return nil, err
+		}
+		r.session = res.Session
+	}
+	r.alive = len(calculateAliveCells(p, world))
+	return r, nil
+}
+
+// advance asks the broker to process the turns, which it may stop short of to keep key presses responsive.
+func (r *remoteSimulation) advance(turns int) (int, []util.Cell, int) {
+	var res AdvanceResponse
+	if err := r.client.Call(brokerAdvance, AdvanceRequest{Session: r.session, Turns: turns}, &res); err != nil {
+		r.failure = err
+		return 0, nil, r.alive
+	}
+	for _, cell := range res.Flipped {
+		r.current[cell.Y][cell.X] ^= 255
+	}
+	r.alive = res.Alive
+	r.recoveries = append(r.recoveries, res.Recoveries...)
+	return res.Turns, res.Flipped, res.Alive
+}
+
+// recovered reports the times the broker has carried on without workers that failed.
+func (r *remoteSimulation) recovered() []WorkersRecovered {
+	events := make([]WorkersRecovered, len(r.recoveries))
+	for i, recovery := range r.recoveries {
+		events[i] = WorkersRecovered{CompletedTurns: recovery.Turn, Failed: recovery.Failed, Workers: recovery.Workers}
+	}
+	r.recoveries = nil
+	return events
+}
+
+func (r *remoteSimulation) world() [][]uint8 {
+	return copyWorld(r.current)
+}
+
+// stop ends the simulation on the broker, which carries on serving other controllers.
+func (r *remoteSimulation) stop() {
+	_ = r.client.Call(brokerStop, StopRequest{Session: r.session}, &StopResponse{})
+	r.client.Close()
+}
+
+// detach leaves the broker to carry on by itself, so that another controller can attach to it later.
+func (r *remoteSimulation) detach() {
+	_ = r.client.Call(brokerDetach, DetachRequest{Session: r.session}, &DetachResponse{})
+	r.client.Close()
+}
+
+func (r *remoteSimulation) err() error {
+	return r.failure
+}
+
+// attach takes over the simulation running on the broker in the params, returning its world, turn and the session
+// that the controller uses from then on. The size, rule, topology and engine of the world are taken from the broker.
+func (io *ioState) attach() ([]uint8, int, int, error) {
+	if io.params.Broker == "" {
+		return nil, 0, 0, fmt.Errorf("attaching needs the address of a broker")
+	}
+	client, err := rpc.Dial("tcp", io.params.Broker)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer client.Close()
+	var res AttachResponse
+	if err := client.Call(brokerAttach, AttachRequest{Turns: io.params.Turns}, &res); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := io.setSize(len(res.World[0]), len(res.World)); err != nil {
+		// the broker carries on by itself rather than waiting for a controller that never comes
+		_ = client.Call(brokerDetach, DetachRequest{Session: res.Session}, &DetachResponse{})
+		return nil, 0, 0, err
+	}
+	io.params.Rule, io.params.Topology, io.params.Engine = res.Rule, res.Topology, res.Engine
+	image := make([]uint8, 0, io.params.ImageWidth*io.params.ImageHeight)
+	for _, row := range res.World {
+		image = append(image, row...)
+	}
+	return image, res.Turn, res.Session, nil
+}
+
+// BrokerParams asks the broker at the address about the simulation it is running, returning its size, rule,
+// topology, engine and number of turns along with its current turn, without attaching to it.
+func BrokerParams(address string) (Params, int, error) {
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		return Params{}, 0, err
+	}
+	defer client.Close()
+	var res StatusResponse
+	if err := client.Call(brokerStatus, StatusRequest{}, &res); err != nil {
+		return Params{}, 0, err
+	}
+	p := Params{Turns: res.Turns, ImageWidth: res.Width, ImageHeight: res.Height,
+		Rule: res.Rule, Topology: res.Topology, Engine: res.Engine, Broker: address}
+	return p, res.Turn, nil
+}
+
+// RegisterWorker asks the broker at the address to use the remote worker at the worker address as well,
+// which it divides any simulation it is running between from the next turn.
+// The address of the worker must be reachable from the broker and all of its other workers.
+func RegisterWorker(broker, worker string) error {
+	client, err := rpc.Dial("tcp", broker)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Call(brokerRegister, RegisterRequest{Address: worker}, &RegisterResponse{})
+}
+
+// DeregisterWorker asks the broker at the address to stop using the remote worker at the worker address.
+// It returns once the broker has divided any simulation it is running between its other workers.
+func DeregisterWorker(broker, worker string) error {
+	client, err := rpc.Dial("tcp", broker)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Call(brokerDeregister, DeregisterRequest{Address: worker}, &DeregisterResponse{})
+}
+
+func copyWorld(world [][]uint8) [][]uint8 {
+	c := make([][]uint8, len(world))
+	for y, row := range world {
+		c[y] = append([]uint8(nil), row...)
+	}
+	return c
+}
@@ -0,0 +1,250 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// pattern is a set of alive cells read from a pattern file, relative to the top left corner of its bounding box.
+type pattern struct {
+	width, height int
+	cells         []util.Cell
+	// rule is the zero Rule if the file does not give one
+	rule Rule
+	// anchored patterns are placed at the top left corner of the world rather than centred
+	anchored bool
+	// sizeOnly patterns keep the bounds of their cells but not the cells themselves, for finding the size of a file
+	sizeOnly bool
+	// bounds holds every cell added so far, even if the cells themselves are not kept
+	bounds bounds
+}
+
+// bounds is the bounding box of a set of cells, with alive only set once it holds a cell.
+type bounds struct {
+	alive    bool
+	min, max util.Cell
+}
+
+// add adds an alive cell to the pattern, or only grows its bounds if just the size is wanted.
+func (p *pattern) add(cell util.Cell) {
+	p.bounds.grow(cell)
+	if !p.sizeOnly {
+		p.cells = append(p.cells, cell)
+	}
+}
+
+// grow makes the bounds big enough to hold the cell.
+func (b *bounds) grow(cell util.Cell) {
+	if !b.alive {
+		b.min, b.max, b.alive = cell, cell, true
+		return
+	}
+	if cell.X < b.min.X {
+		b.min.X = cell.X
+	}
+	if cell.Y < b.min.Y {
+		b.min.Y = cell.Y
+	}
+	if cell.X > b.max.X {
+		b.max.X = cell.X
+	}
+	if cell.Y > b.max.Y {
+		b.max.Y = cell.Y
+	}
+}
+
+// parseRuleHeader parses the rule given in a pattern file, ignoring any bounded grid suffix such as :T64,64.
+func parseRuleHeader(rulestring string) (Rule, error) {
+	if i := strings.Index(rulestring, ":"); i >= 0 {
+		rulestring = rulestring[:i]
+	}
+	return ParseRule(rulestring)
+}
+
+// decodeRle reads a pattern in the run length encoded format, e.g.
+//
+//	#N Glider
+//	x = 3, y = 3, rule = B3/S23
+//	bob$2bo$3o!
+//
+// The header gives the size, so if only the size is wanted nothing after it is read.
+func decodeRle(r io.Reader, sizeOnly bool) (*pattern, error) {
+	scanner := bufio.NewScanner(r)
+	p := &pattern{sizeOnly: sizeOnly}
+	headerFound := false
+	x, y, count := 0, 0, 0
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			// #r is an old way of giving the rule, all other # lines are comments
+			if strings.HasPrefix(line, "#r ") && p.rule == (Rule{}) {
+				rule, err := parseRuleHeader(strings.TrimSpace(line[3:]))
+				if err != nil {
+					return nil, err
+				}
+				p.rule = rule
+			}
+			continue
+		}
+
+		if !headerFound {
+			if err := p.parseRleHeader(line); err != nil {
+				return nil, err
+			}
+			if p.sizeOnly {
+				return p, nil
+			}
+			headerFound = true
+			continue
+		}
+
+		for _, r := range line {
+			switch {
+			case r >= '0' && r <= '9':
+				count = count*10 + int(r-'0')
+				continue
+			case r == ' ' || r == '\t':
+				continue
+			case r == '!':
+				return p, p.checkBounds()
+			}
+
+			run := count
+			if run == 0 {
+				run = 1
+			}
+			count = 0
+			switch r {
+			case 'b', '.':
+				x += run
+			case 'o', 'A':
+				for i := 0; i < run; i++ {
+					p.add(util.Cell{X: x + i, Y: y})
+				}
+				x += run
+			case '$':
+				x = 0
+				y += run
+			default:
+				return nil, fmt.Errorf("unexpected %q in the pattern", r)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !headerFound {
+		return nil, fmt.Errorf("missing the x = , y = header line")
+	}
+	return nil, fmt.Errorf("missing the ! at the end of the pattern")
+}
+
+// parseRleHeader reads the size and rule from a line such as x = 3, y = 3, rule = B3/S23.
+func (p *pattern) parseRleHeader(line string) error {
+	found := map[string]bool{}
+	for _, field := range strings.Split(line, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid header field %q", strings.TrimSpace(field))
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		found[key] = true
+		var err error
+		switch key {
+		case "x":
+			p.width, err = strconv.Atoi(value)
+		case "y":
+			p.height, err = strconv.Atoi(value)
+		case "rule":
+			p.rule, err = parseRuleHeader(value)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid header field %q: %v", strings.TrimSpace(field), err)
+		}
+	}
+	if !found["x"] || !found["y"] {
+		return fmt.Errorf("the header line %q should give x and y", line)
+	}
+	if p.width < 0 || p.height < 0 {
+		return fmt.Errorf("the pattern size %vx%v is negative", p.width, p.height)
+	}
+	return nil
+}
+
+// checkBounds makes sure every cell of the pattern is inside its bounding box.
+func (p *pattern) checkBounds() error {
+	for _, cell := range p.cells {
+		if cell.X >= p.width || cell.Y >= p.height {
+			return fmt.Errorf("cell (%v, %v) is outside the %vx%v pattern", cell.X, cell.Y, p.width, p.height)
+		}
+	}
+	return nil
+}
+
+// encodeRle writes the world in the run length encoded format, with lines no longer than 70 characters.
+func encodeRle(w io.Writer, world [][]uint8, rule Rule) error {
+	height := len(world)
+	width := 0
+	if height > 0 {
+		width = len(world[0])
+	}
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "x = %v, y = %v, rule = %v\n", width, height, rule)
+
+	line := 0
+	emit := func(run int, tag byte) {
+		item := string(tag)
+		if run > 1 {
+			item = strconv.Itoa(run) + item
+		}
+		if line+len(item) > 70 {
+			out.WriteString("\n")
+			line = 0
+		}
+		out.WriteString(item)
+		line += len(item)
+	}
+
+	// empty rows are counted up and written as a single run of $
+	newlines := 0
+	for y, row := range world {
+		// dead cells at the end of a row are left out
+		end := len(row)
+		for end > 0 && row[end-1] != 255 {
+			end--
+		}
+		if end > 0 {
+			if newlines > 0 {
+				emit(newlines, '$')
+				newlines = 0
+			}
+			for x := 0; x < end; {
+				run := 1
+				for x+run < end && (row[x+run] == 255) == (row[x] == 255) {
+					run++
+				}
+				if row[x] == 255 {
+					emit(run, 'o')
+				} else {
+					emit(run, 'b')
+				}
+				x += run
+			}
+		}
+		if y < height-1 {
+			newlines++
+		}
+	}
+	emit(1, '!')
+	out.WriteString("\n")
+	return out.Flush()
+}
@@ -0,0 +1,135 @@
+package gol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rule is a life-like rule written in B/S notation, e.g. B3/S23 for Conway's Game of Life or B36/S23 for HighLife.
+// The zero Rule is Conway's Game of Life.
+type Rule struct {
+	// Birth has bit n set if a dead cell with n alive neighbours becomes alive.
+	Birth uint16
+	// Survival has bit n set if an alive cell with n alive neighbours stays alive.
+	Survival uint16
+}
+
+// Conway is the rule of Conway's Game of Life.
+var Conway = Rule{Birth: 1 << 3, Survival: 1<<2 | 1<<3}
+
+// ParseRule parses a Golly style rulestring such as B36/S23.
+// The letters may be in either case, in either order and the slash is optional.
+// The older S/B notation without letters, e.g. 23/36, is also accepted.
+func ParseRule(rulestring string) (Rule, error) {
+	var rule Rule
+	s := strings.ToUpper(strings.TrimSpace(rulestring))
+	if s == "" {
+		return rule, fmt.Errorf("empty rulestring")
+	}
+
+	if !strings.ContainsAny(s, "BS") {
+		parts := strings.Split(s, "/")
+		if len(parts) != 2 {
+			return rule, fmt.Errorf("rulestring %q should look like B3/S23", rulestring)
+		}
+		s = "S" + parts[0] + "/B" + parts[1]
+	}
+
+	var counts *uint16
+	seen := map[rune]bool{}
+	for _, r := range s {
+		switch {
+		case r == 'B' || r == 'S':
+			if seen[r] {
+				return rule, fmt.Errorf("rulestring %q has more than one %c section", rulestring, r)
+			}
+			seen[r] = true
+			if r == 'B' {
+				counts = &rule.Birth
+			} else {
+				counts = &rule.Survival
+			}
+		case r == '/':
+			if counts == nil {
+				return rule, fmt.Errorf("rulestring %q should start with B or S", rulestring)
+			}
+		case r >= '0' && r <= '8':
+			if counts == nil {
+				return rule, fmt.Errorf("rulestring %q should start with B or S", rulestring)
+			}
+			*counts |= 1 << uint(r-'0')
+		case r == '9':
+			return rule, fmt.Errorf("rulestring %q has a neighbour count above 8", rulestring)
+		default:
+			return rule, fmt.Errorf("rulestring %q contains unexpected character %q", rulestring, r)
+		}
+	}
+	if !seen['B'] || !seen['S'] {
+		return rule, fmt.Errorf("rulestring %q should have both a B and an S section", rulestring)
+	}
+	// B/S can not be told apart from the zero Rule, and every cell dies after one turn anyway
+	if rule == (Rule{}) {
+		return rule, fmt.Errorf("rulestring %q never lets any cell be alive", rulestring)
+	}
+	return rule, nil
+}
+
+// orDefault replaces the zero Rule with Conway's Game of Life.
+func (rule Rule) orDefault() Rule {
+	if rule == (Rule{}) {
+		return Conway
+	}
+	return rule
+}
+
+// Next returns whether a cell is alive in the next turn given whether it is alive now and its number of alive neighbours.
+func (rule Rule) Next(alive bool, neighbours int) bool {
+	rule = rule.orDefault()
+	if alive {
+		return rule.Survival&(1<<uint(neighbours)) != 0
+	}
+	return rule.Birth&(1<<uint(neighbours)) != 0
+}
+
+// String returns the rule in B/S notation.
+func (rule Rule) String() string {
+	rule = rule.orDefault()
+	var b strings.Builder
+	b.WriteString("B")
+	for n := 0; n <= 8; n++ {
+		if rule.Birth&(1<<uint(n)) != 0 {
+			fmt.Fprint(&b, n)
+		}
+	}
+	b.WriteString("/S")
+	for n := 0; n <= 8; n++ {
+		if rule.Survival&(1<<uint(n)) != 0 {
+			fmt.Fprint(&b, n)
+		}
+	}
+	return b.String()
+}
+
+// Set allows a Rule to be parsed from a rulestring using the flag package.
+func (rule *Rule) Set(rulestring string) error {
+	r, err := ParseRule(rulestring)
+	if err != nil {
+		return err
+	}
+	*rule = r
+	return nil
+}
+
+// table returns the next state of a cell indexed by its current state (0 or 1) and its number of alive neighbours.
+func (rule Rule) table() [2][9]uint8 {
+	var table [2][9]uint8
+	for n := 0; n <= 8; n++ {
+		if rule.Next(false, n) {
+			table[0][n] = 1
+		}
+		if rule.Next(true, n) {
+			table[1][n] = 1
+		}
+	}
+	return table
+}
@@ -0,0 +1,261 @@
+package gol
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// RemoteWorker keeps a strip of the world for a broker, using the same strips as the local workers.
+// Every step it sends the top and bottom rows of its strip directly to the workers above and below it,
+// so only those rows and the number of alive cells cross the network each turn.
+type RemoteWorker struct {
+	mu sync.Mutex
+	// strip is nil until one is loaded
+	strip      strip
+	generation int
+	y1, y2     int
+	turn       int
+	// columns is only used by the cross-surface topology
+	columns      *edgeColumns
+	above, below *rpc.Client
+	// last is the strip when the broker last asked for the cells that changed
+	last [][]uint8
+
+	// the halo rows are received without locking, as the worker is locked while it waits for them.
+	// A neighbour can only send the rows of the next turn once every worker has finished this one.
+	fromAbove, fromBelow chan haloDelivery
+}
+
+// haloDelivery is a row received from a neighbouring worker. The neighbour waits for it to be taken,
+// so that it finds out if this worker fails before the row is used.
+type haloDelivery struct {
+	HaloRequest
+	taken chan struct{}
+}
+
+// ServeWorker serves brokers on the listener until it is closed.
+func ServeWorker(l net.Listener) error {
+	server := rpc.NewServer()
+	w := &RemoteWorker{fromAbove: make(chan haloDelivery, 1), fromBelow: make(chan haloDelivery, 1)}
+	if err := server.Register(w); err != nil {
+		return err
+	}
+	server.Accept(l)
+	return nil
+}
+
+// Load replaces any strip the worker already has and connects to its neighbours.
+func (w *RemoteWorker) Load(req LoadRequest, res *LoadResponse) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(req.Rows) == 0 || req.Y1 < 0 || req.Y1+len(req.Rows) > req.Height || req.Width <= 0 {
+		return fmt.Errorf("%v rows from row %v are not in a world %v rows high", len(req.Rows), req.Y1, req.Height)
+	}
+	w.unload()
+
+	above, err := rpc.Dial("tcp", req.Above)
+	if err != nil {
+		return fmt.Errorf("the worker above: %v", err)
+	}
+	below := above
+	if req.Below != req.Above {
+		if below, err = rpc.Dial("tcp", req.Below); err != nil {
+			above.Close()
+			return fmt.Errorf("the worker below: %v", err)
+		}
+	}
+
+	// the strip is made from a world with only its own rows, as the others are never read
+	empty := make([]uint8, req.Width)
+	world := make([][]uint8, req.Height)
+	for y := range world {
+		world[y] = empty
+	}
+	copy(world[req.Y1:], req.Rows)
+	p := Params{Rule: req.Rule, Topology: req.Topology, Engine: req.Engine}
+	if p.Topology == CrossSurface {
+		w.columns = newEdgeColumns(world)
+	}
+	w.y1, w.y2 = req.Y1, req.Y1+len(req.Rows)-1
+	w.strip = newStrip(p, world, w.y1, w.y2, w.columns)
+	w.generation, w.turn = req.Generation, 0
+	w.above, w.below = above, below
+	w.last = w.strip.rows()
+	return nil
+}
+
+// unload drops the current strip, closes the connections to its neighbours and drops any rows left over from them.
+// The worker must be locked.
+func (w *RemoteWorker) unload() {
+	if w.above != nil {
+		w.above.Close()
+	}
+	if w.below != nil && w.below != w.above {
+		w.below.Close()
+	}
+	w.strip, w.above, w.below = nil, nil, nil
+	w.columns, w.last = nil, nil
+	for _, c := range []chan haloDelivery{w.fromAbove, w.fromBelow} {
+		select {
+		case d := <-c:
+			close(d.taken)
+		default:
+		}
+	}
+}
+
+// Step exchanges rows with the neighbouring workers and then calculates the next state of the strip.
+func (w *RemoteWorker) Step(req StepRequest, res *StepResponse) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.strip == nil {
+		return fmt.Errorf("the worker has no strip")
+	}
+	if w.columns != nil {
+		if len(req.First) != len(w.columns.first[0]) || len(req.Last) != len(w.columns.last[0]) {
+			return fmt.Errorf("the columns of the world are missing")
+		}
+		copy(w.columns.first[w.turn%2], req.First)
+		copy(w.columns.last[w.turn%2], req.Last)
+	}
+
+	// the rows are sent as soon as the call is made, so the strip can be changed while waiting for the replies
+	top, bottom := w.strip.edges()
+	sent := make(chan *rpc.Call, 2)
+	w.above.Go(workerHaloRPC, w.haloRequest(top, true), &HaloResponse{}, sent)
+	w.below.Go(workerHaloRPC, w.haloRequest(bottom, false), &HaloResponse{}, sent)
+	above, below, err := w.exchange(sent)
+	if err != nil {
+		return err
+	}
+	w.strip.setHalo(above, below)
+
+	_, res.Alive = w.strip.step()
+	w.turn++
+	if w.columns != nil {
+		res.First = append([]uint8(nil), w.columns.first[w.turn%2][w.y1:w.y2+1]...)
+		res.Last = append([]uint8(nil), w.columns.last[w.turn%2][w.y1:w.y2+1]...)
+	}
+	return nil
+}
+
+// exchange waits for the neighbouring workers to take the rows sent to them and for their rows in return.
+// It gives up as soon as a neighbour fails, or once workerTimeout has passed if one stops responding.
+// Rows left over from an earlier strip or turn are dropped. The worker must be locked.
+func (w *RemoteWorker) exchange(sent <-chan *rpc.Call) (above, below halo, err error) {
+	timeout := time.NewTimer(workerTimeout)
+	defer timeout.Stop()
+	for pending := 2; pending > 0 || above == nil || below == nil; {
+		select {
+		case call := <-sent:
+			if call.Error != nil {
+				return nil, nil, fmt.Errorf("sending a row to a neighbour: %v", call.Error)
+			}
+			pending--
+		case d := <-w.fromAbove:
+			close(d.taken)
+			if d.Generation == w.generation && d.Turn == w.turn {
+				above = d.row()
+			}
+		case d := <-w.fromBelow:
+			close(d.taken)
+			if d.Generation == w.generation && d.Turn == w.turn {
+				below = d.row()
+			}
+		case <-timeout.C:
+			return nil, nil, fmt.Errorf("the neighbouring workers did not respond within %v", workerTimeout)
+		}
+	}
+	return above, below, nil
+}
+
+// haloRequest puts a row of either kind of strip into a message. The worker must be locked.
+func (w *RemoteWorker) haloRequest(h halo, fromBelow bool) HaloRequest {
+	req := HaloRequest{Generation: w.generation, Turn: w.turn, FromBelow: fromBelow}
+	switch row := h.(type) {
+	case []uint8:
+		req.Bytes = row
+	case []uint64:
+		req.Words = row
+	}
+	return req
+}
+
+// row returns the row in the message as either kind of halo.
+func (req HaloRequest) row() halo {
+	if req.Words != nil {
+		return req.Words
+	}
+	return req.Bytes
+}
+
+// Halo receives a row from a neighbouring worker, replying once the row has been taken.
+func (w *RemoteWorker) Halo(req HaloRequest, res *HaloResponse) error {
+	c := w.fromAbove
+	if req.FromBelow {
+		c = w.fromBelow
+	}
+	d := haloDelivery{HaloRequest: req, taken: make(chan struct{})}
+	timeout := time.NewTimer(workerTimeout)
+	defer timeout.Stop()
+	select {
+	case c <- d:
+	case <-timeout.C:
+		return fmt.Errorf("the worker is not waiting for rows")
+	}
+	select {
+	case <-d.taken:
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("the worker did not take the row within %v", workerTimeout)
+	}
+}
+
+// Ping replies straight away, even while the worker is busy, so the broker can tell which workers are still running.
+func (w *RemoteWorker) Ping(req PingRequest, res *PingResponse) error {
+	return nil
+}
+
+// Unload drops the strip and closes the connections to the neighbours, so nothing is kept until the next Load.
+func (w *RemoteWorker) Unload(req UnloadRequest, res *UnloadResponse) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.unload()
+	return nil
+}
+
+// Changes returns the cells of the strip that have changed since it was loaded or last asked.
+func (w *RemoteWorker) Changes(req ChangesRequest, res *ChangesResponse) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.strip == nil {
+		return fmt.Errorf("the worker has no strip")
+	}
+	rows := w.strip.rows()
+	for j, row := range rows {
+		for x, cell := range row {
+			if cell != w.last[j][x] {
+				res.Flipped = append(res.Flipped, util.Cell{X: x, Y: w.y1 + j})
+			}
+		}
+	}
+	w.last = rows
+	return nil
+}
+
+// Rows returns the strip, which any later changes are counted from.
+func (w *RemoteWorker) Rows(req RowsRequest, res *RowsResponse) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.strip == nil {
+		return fmt.Errorf("the worker has no strip")
+	}
+	res.Rows = w.strip.rows()
+	w.last = res.Rows
+	return nil
+}
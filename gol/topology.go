@@ -0,0 +1,95 @@
+package gol
+
+import (
+	"fmt"
+)
+
+// Topology decides which cells are the neighbours of the cells on the edges of the world.
+type Topology int
+
+const (
+	// Torus wraps around both the left and right edges and the top and bottom edges.
+	Torus Topology = iota
+	// Plane treats every cell beyond the edges of the world as dead.
+	Plane
+	// Reflect mirrors the world at its edges, so the cells beyond each edge are copies of the cells on it.
+	Reflect
+	// KleinBottle wraps like a torus, except crossing the top or bottom edge also flips the world from left to right.
+	KleinBottle
+	// CrossSurface is a Klein bottle that also flips the world from top to bottom when crossing the left or right edge.
+	// The neighbours of each corner are found by crossing the left or right edge first.
+	CrossSurface
+)
+
+var topologyNames = map[Topology]string{
+	Torus:        "torus",
+	Plane:        "plane",
+	Reflect:      "reflect",
+	KleinBottle:  "klein",
+	CrossSurface: "cross",
+}
+
+func (topology Topology) String() string {
+	if name, ok := topologyNames[topology]; ok {
+		return name
+	}
+	return "Incorrect Topology"
+}
+
+// Set allows a Topology to be chosen by name using the flag package.
+func (topology *Topology) Set(name string) error {
+	for t, n := range topologyNames {
+		if n == name {
+			*topology = t
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown topology %q", name)
+}
+
+// flipsVertically returns whether crossing the top or bottom edge of the world flips it from left to right.
+func (topology Topology) flipsVertically() bool {
+	return topology == KleinBottle || topology == CrossSurface
+}
+
+// edgeColumns holds the first and last column of the whole world, which is needed on every row of a cross-surface
+// because crossing the left or right edge lands on the opposite row of the world, owned by a different worker.
+// Workers write the columns of the next turn into one copy while the current turn is read from the other, and the
+// pool waits for every worker to finish a turn before starting the next so the copies are never used at the same time.
+type edgeColumns struct {
+	first, last [2][]uint8
+}
+
+func newEdgeColumns(world [][]uint8) *edgeColumns {
+	height := len(world)
+	columns := &edgeColumns{}
+	for i := range columns.first {
+		columns.first[i] = make([]uint8, height)
+		columns.last[i] = make([]uint8, height)
+	}
+	for y, row := range world {
+		columns.set(0, y, row[0]/255, row[len(row)-1]/255)
+	}
+	return columns
+}
+
+// set stores the first and last cell (0 or 1) of row y at the given turn.
+func (columns *edgeColumns) set(turn, y int, first, last uint8) {
+	columns.first[turn%2][y] = first
+	columns.last[turn%2][y] = last
+}
+
+// sides returns the cells (0 or 1) to the left and right of row y at the given turn.
+// Row y may be the row just above or just below the world.
+func (columns *edgeColumns) sides(turn, y int) (left, right uint8) {
+	first, last := columns.first[turn%2], columns.last[turn%2]
+	height := len(first)
+	switch {
+	case y < 0:
+		return first[0], last[0]
+	case y >= height:
+		return first[height-1], last[height-1]
+	default:
+		return last[height-1-y], first[height-1-y]
+	}
+}
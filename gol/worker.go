@@ -4,59 +4,316 @@ import (
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
-// sends event when cell value changes to notify gui
-func setCell(y, x int, world func(y, x int) uint8, newValue uint8, events chan<- Event, turn int) {
-	if world(y, x) != newValue {
-		events <- CellFlipped{CompletedTurns: turn, Cell: util.Cell{X: x, Y: y}}
-	}
-}
-
-// takes y bounds for given slice of the image and calculates the next state of the world for that slice
-func worker(p Params, y1, y2 int, world func(y, x int) uint8, res chan<- [][]uint8, turn int, events chan<- Event) {
-	slice := (y2 - y1) + 1
-
-	newWorld := make([][]byte, slice)
-	for i := range newWorld {
-		newWorld[i] = make([]byte, p.ImageWidth)
-	}
-
-	// go through each row and column and calculate if the cell should be alive or dead
-	for i := 0; i < p.ImageWidth; i++ {
-		for j := 0; j < slice; j++ {
-			aliveNeighbors := 0
-			// check the 8 neighbors of the cell
-			for x := -1; x <= 1; x++ {
-				for y := -1; y <= 1; y++ {
-					if x == 0 && y == 0 {
-						continue
-					}
-					// check if the neighbor is alive
-					x_neighbour := (i + x + p.ImageWidth) % p.ImageWidth
-					y_neighbour := (j + y + p.ImageHeight) % p.ImageHeight
-
-					if world(y_neighbour, x_neighbour) == 255 {
-						aliveNeighbors++
-					}
-				}
+// workerCommand allows requesting behaviour from a worker goroutine.
+type workerCommand uint8
+
+const (
+	workerStep workerCommand = iota
+	workerSnapshot
+)
+
+// workerResult is sent back to the pool once a worker has finished a command.
+type workerResult struct {
+	flipped []util.Cell
+	alive   int
+	rows    [][]uint8
+}
+
+type workerChannels struct {
+	commands <-chan workerCommand
+	results  chan<- workerResult
+
+	// halo rows are exchanged directly with the neighbouring workers every turn
+	toAbove   chan<- halo
+	toBelow   chan<- halo
+	fromAbove <-chan halo
+	fromBelow <-chan halo
+}
+
+// halo is a row shared between neighbouring workers. Its type depends on the strip that sends it.
+type halo interface{}
+
+// strip is the part of the world owned by a single worker.
+type strip interface {
+	// edges returns the first and last rows of the strip to be sent to the neighbouring workers.
+	edges() (top, bottom halo)
+	// setHalo stores the rows received from the neighbouring workers.
+	setHalo(above, below halo)
+	// step calculates the next state of the strip, returning the cells that changed and the number of alive cells.
+	step() ([]util.Cell, int)
+	// rows returns a copy of the strip in the 0 or 255 format used by the rest of the program.
+	rows() [][]uint8
+}
+
+// newStrip creates the strip of rows y1 to y2 of the world for the engine in p.
+// columns is only needed by the cross-surface topology and may be nil otherwise.
+func newStrip(p Params, world [][]uint8, y1, y2 int, columns *edgeColumns) strip {
+	switch p.Engine {
+	case PackedEngine:
+		return newPackedStrip(p, world, y1, y2, columns)
+	default:
+		return newByteStrip(p, world, y1, y2, columns)
+	}
+}
+
+// byteStrip stores each cell of a strip in its own byte.
+// Both buffers have a one cell border around the strip: rows 0 and height+1 hold the
+// halo rows received from the neighbouring workers and columns 0 and width+1 hold the
+// cells beyond the left and right edges of the world, so the next state can be calculated
+// without any modulo arithmetic. Cells are stored as 0 or 1 so that neighbours can simply be summed.
+type byteStrip struct {
+	y1            int
+	width, height int
+	worldHeight   int
+	turn          int
+	rule          [2][9]uint8
+	topology      Topology
+	columns       *edgeColumns
+	current, next [][]uint8
+}
+
+func newByteStrip(p Params, world [][]uint8, y1, y2 int, columns *edgeColumns) *byteStrip {
+	s := &byteStrip{
+		y1:          y1,
+		width:       len(world[0]),
+		height:      (y2 - y1) + 1,
+		worldHeight: len(world),
+		rule:        p.Rule.table(),
+		topology:    p.Topology,
+		columns:     columns,
+	}
+	s.current = makePaddedRows(s.height, s.width)
+	s.next = makePaddedRows(s.height, s.width)
+	for j := 0; j < s.height; j++ {
+		for i, cell := range world[y1+j] {
+			if cell == 255 {
+				s.current[j+1][i+1] = 1
 			}
-			if world(j, i) == 255 {
-				if aliveNeighbors < 2 || aliveNeighbors > 3 {
-					setCell(j, i, world, 0, events, turn)
-					newWorld[j][i] = 0
-				} else {
-					setCell(j, i, world, 255, events, turn)
-					newWorld[j][i] = 255
-				}
-			} else {
-				if aliveNeighbors == 3 {
-					setCell(j, i, world, 255, events, turn)
-					newWorld[j][i] = 255
-				} else {
-					setCell(j, i, world, 0, events, turn)
-					newWorld[j][i] = 0
-				}
+		}
+	}
+	return s
+}
+
+func makePaddedRows(height, width int) [][]uint8 {
+	rows := make([][]uint8, height+2)
+	for i := range rows {
+		rows[i] = make([]uint8, width+2)
+	}
+	return rows
+}
+
+// edges returns the first and last rows of the strip without their border cells.
+func (s *byteStrip) edges() (top, bottom halo) {
+	return s.current[1][1 : s.width+1], s.current[s.height][1 : s.width+1]
+}
+
+// setHalo copies the rows received from the neighbouring workers into the border and fills in the columns.
+func (s *byteStrip) setHalo(above, below halo) {
+	top, bottom := s.current[0][1:s.width+1], s.current[s.height+1][1:s.width+1]
+	copy(top, above.([]uint8))
+	copy(bottom, below.([]uint8))
+	if s.y1 == 0 {
+		s.beyondEdge(top, s.current[1][1:s.width+1])
+	}
+	if s.y1+s.height == s.worldHeight {
+		s.beyondEdge(bottom, s.current[s.height][1:s.width+1])
+	}
+	for j, row := range s.current {
+		row[0], row[s.width+1] = s.sides(j)
+	}
+}
+
+// beyondEdge replaces a halo row received from the other side of the top or bottom edge of the world.
+// edge is the row of the strip on this side of the edge.
+func (s *byteStrip) beyondEdge(halo, edge []uint8) {
+	switch {
+	case s.topology == Plane:
+		for i := range halo {
+			halo[i] = 0
+		}
+	case s.topology == Reflect:
+		copy(halo, edge)
+	case s.topology.flipsVertically():
+		for i, j := 0, len(halo)-1; i < j; i, j = i+1, j-1 {
+			halo[i], halo[j] = halo[j], halo[i]
+		}
+	}
+}
+
+// sides returns the cells beyond the left and right edges of the world for row j of the buffer.
+func (s *byteStrip) sides(j int) (left, right uint8) {
+	row := s.current[j]
+	switch s.topology {
+	case Plane:
+		return 0, 0
+	case Reflect:
+		return row[1], row[s.width]
+	case CrossSurface:
+		return s.columns.sides(s.turn, s.y1+j-1)
+	default:
+		return row[s.width], row[1]
+	}
+}
+
+func (s *byteStrip) step() ([]util.Cell, int) {
+	var flipped []util.Cell
+	alive := 0
+	for j := 1; j <= s.height; j++ {
+		above, row, below := s.current[j-1], s.current[j], s.current[j+1]
+		newRow := s.next[j]
+		for i := 1; i <= s.width; i++ {
+			aliveNeighbours := above[i-1] + above[i] + above[i+1] +
+				row[i-1] + row[i+1] +
+				below[i-1] + below[i] + below[i+1]
+
+			cell := s.rule[row[i]][aliveNeighbours]
+			alive += int(cell)
+			if cell != row[i] {
+				flipped = append(flipped, util.Cell{X: i - 1, Y: s.y1 + j - 1})
 			}
+			newRow[i] = cell
 		}
+		if s.columns != nil {
+			s.columns.set(s.turn+1, s.y1+j-1, newRow[1], newRow[s.width])
+		}
+	}
+	s.current, s.next = s.next, s.current
+	s.turn++
+	return flipped, alive
+}
+
+func (s *byteStrip) rows() [][]uint8 {
+	rows := make([][]uint8, s.height)
+	for j := range rows {
+		rows[j] = make([]uint8, s.width)
+		for i := range rows[j] {
+			rows[j][i] = s.current[j+1][i+1] * 255
+		}
+	}
+	return rows
+}
+
+// worker owns a strip of the world for the whole run and calculates its next state every time it is told to step.
+// Only the top and bottom rows of the strip are shared with the neighbouring workers.
+func worker(s strip, c workerChannels) {
+	for command := range c.commands {
+		switch command {
+		case workerStep:
+			top, bottom := s.edges()
+			c.toAbove <- top
+			c.toBelow <- bottom
+			s.setHalo(<-c.fromAbove, <-c.fromBelow)
+			flipped, alive := s.step()
+			c.results <- workerResult{flipped: flipped, alive: alive}
+		case workerSnapshot:
+			c.results <- workerResult{rows: s.rows()}
+		}
+	}
+}
+
+// workerPool is a set of long lived workers which each own a horizontal strip of the world.
+type workerPool struct {
+	commands []chan workerCommand
+	results  []chan workerResult
+}
+
+// newWorkerPool divides up the world between p.Threads workers and starts them.
+func newWorkerPool(p Params, world [][]uint8) *workerPool {
+	threads := p.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	if threads > p.ImageHeight {
+		threads = p.ImageHeight
 	}
-	res <- newWorld
+
+	pool := &workerPool{
+		commands: make([]chan workerCommand, threads),
+		results:  make([]chan workerResult, threads),
+	}
+
+	// upwards[i] carries the top row of worker i to the worker above it and downwards[i]
+	// carries its bottom row to the worker below. They are buffered so a worker can send
+	// both of its rows before receiving, and the pool waits for every worker to finish a
+	// turn before starting the next one so the rows are never overwritten while being read.
+	upwards := make([]chan halo, threads)
+	downwards := make([]chan halo, threads)
+	for i := 0; i < threads; i++ {
+		pool.commands[i] = make(chan workerCommand)
+		pool.results[i] = make(chan workerResult)
+		upwards[i] = make(chan halo, 1)
+		downwards[i] = make(chan halo, 1)
+	}
+
+	var columns *edgeColumns
+	if p.Topology == CrossSurface {
+		columns = newEdgeColumns(world)
+	}
+
+	for i := 0; i < threads; i++ {
+		y1, y2 := stripRows(p.ImageHeight, threads, i)
+		above := (i - 1 + threads) % threads
+		below := (i + 1) % threads
+		go worker(newStrip(p, world, y1, y2, columns), workerChannels{
+			commands:  pool.commands[i],
+			results:   pool.results[i],
+			toAbove:   upwards[i],
+			toBelow:   downwards[i],
+			fromAbove: downwards[above],
+			fromBelow: upwards[below],
+		})
+	}
+	return pool
+}
+
+// stripRows returns the first and last rows of strip i when a world of the given height is divided into strips.
+func stripRows(height, strips, i int) (y1, y2 int) {
+	// divides up world between threads
+	vDiff := height / strips
+	y1 = i * vDiff
+	y2 = ((i + 1) * vDiff) - 1
+	// handles remainder e.g. if num of threads is odd
+	if i == strips-1 {
+		y2 += height % strips
+	}
+	return y1, y2
+}
+
+// advance processes a single turn on every strip, returning the cells that changed and the number of alive cells.
+func (pool *workerPool) advance(turns int) (int, []util.Cell, int) {
+	for _, commands := range pool.commands {
+		commands <- workerStep
+	}
+	var flipped []util.Cell
+	alive := 0
+	for _, results := range pool.results {
+		res := <-results
+		flipped = append(flipped, res.flipped...)
+		alive += res.alive
+	}
+	return 1, flipped, alive
+}
+
+// world collects a copy of the current world from the workers.
+func (pool *workerPool) world() [][]uint8 {
+	for _, commands := range pool.commands {
+		commands <- workerSnapshot
+	}
+	world := make([][]uint8, 0)
+	for _, results := range pool.results {
+		// blocks on channels sequentially so no need for additional processing for ordering
+		world = append(world, (<-results).rows...)
+	}
+	return world
+}
+
+// stop shuts down all of the workers.
+func (pool *workerPool) stop() {
+	for _, commands := range pool.commands {
+		close(commands)
+	}
+}
+
+func (pool *workerPool) err() error {
+	return nil
 }
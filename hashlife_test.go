@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestHashLife tests the HashLife engine on 16x16, 64x64 and 512x512 images on 0, 1 and 100 turns,
+// and then checks the number of alive cells after a very large number of turns.
+func TestHashLife(t *testing.T) {
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64},
+		{ImageWidth: 512, ImageHeight: 512},
+	}
+	for _, p := range tests {
+		p.Engine = gol.HashLifeEngine
+		for _, turns := range []int{0, 1, 100} {
+			p.Turns = turns
+			expectedAlive := readAliveCells(
+				"check/images/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			testName := fmt.Sprintf("%dx%dx%d", p.ImageWidth, p.ImageHeight, p.Turns)
+			t.Run(testName, func(t *testing.T) {
+				assertEqualBoard(t, runFinal(p), expectedAlive, p)
+			})
+		}
+	}
+
+	alive := readAliveCounts(512, 512)
+	for _, turns := range []int{10000, 1000000, 10000000000} {
+		p := gol.Params{Turns: turns, ImageWidth: 512, ImageHeight: 512, Engine: gol.HashLifeEngine}
+		t.Run(fmt.Sprintf("512x512x%d", turns), func(t *testing.T) {
+			expected := 5565
+			if turns <= 10000 {
+				expected = alive[turns]
+			}
+			cells := runFinal(p)
+			assert(t, len(cells) == expected, "At turn %v expected %v alive cells, got %v instead", turns, expected, len(cells))
+		})
+	}
+}
+
+// TestHashLifeUnsupported tests that worlds the HashLife engine can not simulate fail to start rather than
+// quietly using another engine.
+func TestHashLifeUnsupported(t *testing.T) {
+	for _, p := range []gol.Params{
+		{Turns: 10, ImageWidth: 16, ImageHeight: 16, Topology: gol.KleinBottle},
+		{Turns: 10, ImageWidth: 64, ImageHeight: 64, Topology: gol.Plane},
+		{Turns: 10, ImageWidth: 64, ImageHeight: 32},
+		{Turns: 10, ImageWidth: 48, ImageHeight: 48},
+	} {
+		t.Run(fmt.Sprintf("%vx%v_%v", p.ImageWidth, p.ImageHeight, p.Topology), func(t *testing.T) {
+			// there are no images of every size, so a glider is put in the middle of the world
+			p.InputFile = writePattern(t, "glider.rle", glider)
+			cells := runFinal(p)
+			assert(t, len(cells) == 5, "the glider should run on the bytes engine, not leave %v cells", len(cells))
+			p.Engine = gol.HashLifeEngine
+			expectRefused(t, p)
+		})
+	}
+}
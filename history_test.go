@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestHistory tests stepping backwards with b while paused.
+func TestHistory(t *testing.T) {
+	for _, engine := range []gol.Engine{gol.ByteEngine, gol.PackedEngine, gol.HashLifeEngine} {
+		t.Run(engine.String(), func(t *testing.T) {
+			testHistory(t, gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16, Engine: engine})
+		})
+	}
+	t.Run("Limit", testHistoryLimit)
+}
+
+func testHistory(t *testing.T, p gol.Params) {
+	// step forward 5 turns, back 4 to turn 1, then back as far as possible to turn 0
+	turns, worlds, final := runKeys(t, p, "pnnnnnb3b9bq")
+	expected := []int{1, 2, 3, 4, 5, 4, 1, 0}
+	if len(turns) != len(expected) {
+		t.Fatalf("ERROR: Expected TurnComplete for turns %v, got %v", expected, turns)
+	}
+	for i := range expected {
+		assert(t, turns[i] == expected[i], "Expected TurnComplete for turns %v, got %v", expected, turns)
+	}
+	assert(t, final == 0, "FinalTurnComplete should have a CompletedTurns of 0, not %v", final)
+
+	assertEqualBoard(t, worlds[5], worlds[3], p)
+	assertEqualBoard(t, worlds[6], readAliveCells("check/images/16x16x1.pgm", 16, 16), p)
+	assertEqualBoard(t, worlds[7], readAliveCells("images/16x16.pgm", 16, 16), p)
+}
+
+func testHistoryLimit(t *testing.T) {
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16, History: 2}
+
+	// only the last 2 turns can be undone
+	turns, worlds, _ := runKeys(t, p, "pnnnn9bbq")
+	expected := []int{1, 2, 3, 4, 2}
+	if len(turns) != len(expected) {
+		t.Fatalf("ERROR: Expected TurnComplete for turns %v, got %v", expected, turns)
+	}
+	assert(t, turns[4] == 2, "Expected TurnComplete for turns %v, got %v", expected, turns)
+	assertEqualBoard(t, worlds[4], worlds[1], p)
+
+	p.History = -1
+	turns, _, _ = runKeys(t, p, "pnnbq")
+	assert(t, len(turns) == 2, "Expected no TurnComplete after b without a history, got %v", turns)
+}
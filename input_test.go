@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestInput tests loading images from arbitrary paths with the size taken from the image header.
+func TestInput(t *testing.T) {
+	for _, size := range []int{16, 64} {
+		data, err := os.ReadFile(fmt.Sprintf("images/%vx%v.pgm", size, size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "pattern.pgm")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		width, height, err := gol.ImageSize(path)
+		assert(t, err == nil && width == size && height == size,
+			"ImageSize should return %v, %v for %v, not %v, %v (%v)", size, size, path, width, height, err)
+
+		emptyOutFolder()
+		p := gol.Params{Turns: 1, Threads: 4, InputFile: path}
+		t.Run(fmt.Sprintf("%dx%d", size, size), func(t *testing.T) {
+			expectedAlive := readAliveCells(fmt.Sprintf("check/images/%vx%vx1.pgm", size, size), size, size)
+			cells := runFinal(p)
+			p.ImageWidth, p.ImageHeight = size, size
+			assertEqualBoard(t, cells, expectedAlive, p)
+			// the output is named after the size read from the header
+			outputAlive := readAliveCells(fmt.Sprintf("out/%vx%vx1.pgm", size, size), size, size)
+			assertEqualBoard(t, outputAlive, expectedAlive, p)
+		})
+	}
+}
+
+// TestPgmInput tests reading pgm images with comments, the plain P2 format and other maximum values.
+func TestPgmInput(t *testing.T) {
+	size := 16
+	alive := readAliveCells("images/16x16.pgm", size, size)
+	isAlive := make(map[util.Cell]bool)
+	for _, cell := range alive {
+		isAlive[cell] = true
+	}
+	p := gol.Params{ImageWidth: size, ImageHeight: size}
+
+	// raster writes every pixel using deadValue or aliveValue, formatted by write
+	raster := func(deadValue, aliveValue int, write func(b *bytes.Buffer, value int)) []byte {
+		var b bytes.Buffer
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				if isAlive[util.Cell{X: x, Y: y}] {
+					write(&b, aliveValue)
+				} else {
+					write(&b, deadValue)
+				}
+			}
+		}
+		return b.Bytes()
+	}
+	oneByte := func(b *bytes.Buffer, value int) { b.WriteByte(byte(value)) }
+	twoBytes := func(b *bytes.Buffer, value int) { b.Write([]byte{byte(value >> 8), byte(value)}) }
+	plain := func(b *bytes.Buffer, value int) { fmt.Fprintf(b, "%v\n", value) }
+
+	tests := []struct {
+		name      string
+		header    string
+		raster    []byte
+		threshold float64
+	}{
+		{"comments", "P5\n# a comment\n16 # another\n16\n255\n", raster(0, 255, oneByte), 0},
+		{"whitespace", "P5 16 16 255\n", raster(' ', '\n'+200, oneByte), 0},
+		{"plain", "P2\n# plain\n16 16\n1\n", raster(0, 1, plain), 0},
+		{"maxval", "P5\n16 16\n65535\n", raster(1000, 40000, twoBytes), 0},
+		{"threshold", "P2 16 16 100\n", raster(20, 30, plain), 0.25},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image.pgm")
+			if err := os.WriteFile(path, append([]byte(test.header), test.raster...), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cells := runFinal(gol.Params{InputFile: path, Threshold: test.threshold})
+			assertEqualBoard(t, cells, alive, p)
+		})
+	}
+
+	invalid := map[string]string{
+		"format":    "P6\n16 16\n255\n",
+		"truncated": "P5\n16 16\n255\n\x00\x00",
+		"size":      "P5\n8 8\n255\n",
+		"value":     "P2\n16 16\n1\n2\n",
+		"header":    "P5\n16 sixteen\n255\n",
+	}
+	for name, data := range invalid {
+		t.Run(name, func(t *testing.T) {
+			expectRefused(t, gol.Params{ImageWidth: size, ImageHeight: size, InputFile: writePattern(t, "image.pgm", data)})
+		})
+	}
+}
+
+// TestImageSize tests reading the size of each format without its cells, which need not even be there.
+func TestImageSize(t *testing.T) {
+	var deep bytes.Buffer
+	deep.WriteString("[M2] (golly 4.2)\n$$..*$...*$.***$\n4 0 0 0 1\n")
+	for level := 5; level <= 41; level++ {
+		fmt.Fprintf(&deep, "%v %v 0 0 0\n", level, level-3)
+	}
+
+	tests := []struct {
+		name          string
+		data          string
+		width, height int
+	}{
+		{"header.pgm", "P5\n16 8\n255\n", 16, 8},
+		{"header.pbm", "P4 24 5\n", 24, 5},
+		{"header.rle", "#N no cells after the header\nx = 5, y = 7, rule = B3/S23\n", 5, 7},
+		{"glider.cells", "!Name: Glider\n.O.\n..O\nOOO\n", 3, 3},
+		{"anchored.lif", "#Life 1.06\n4 2\n", 5, 3},
+		{"centred.lif", "#Life 1.06\n-1 -1\n1 1\n", 3, 3},
+		{"deep.mc", deep.String(), 3, 3},
+		{"empty.cells", "!Name: Empty\n", 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			width, height, err := gol.ImageSize(writePattern(t, test.name, test.data))
+			if test.width == 0 {
+				assert(t, err != nil, "reading the size of an empty pattern should fail, not give %vx%v", width, height)
+				return
+			}
+			assert(t, err == nil && width == test.width && height == test.height,
+				"the size should be %vx%v, not %vx%v (%v)", test.width, test.height, width, height, err)
+		})
+	}
+}
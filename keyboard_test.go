@@ -15,6 +15,9 @@ func TestKeyboard(t *testing.T) {
 	t.Run("q", testKeyboardQ)
 	t.Run("p+s", testKeyboardPS)
 	t.Run("p+q", testKeyboardPQ)
+	t.Run("k", testKeyboardK)
+	t.Run("p+n", testKeyboardPN)
+	t.Run("-+", testKeyboardSpeed)
 }
 
 func testKeyboardP(t *testing.T) {
@@ -201,3 +204,134 @@ func testKeyboardPQ(t *testing.T) {
 
 	tester.Loop()
 }
+
+func testKeyboardK(t *testing.T) {
+	params := gol.Params{
+		Turns:       100000000,
+		Threads:     8,
+		ImageWidth:  512,
+		ImageHeight: 512,
+	}
+
+	keyPresses := make(chan rune, 10)
+	events := make(chan gol.Event, 1000)
+
+	golDone := make(chan bool, 1)
+
+	go func() {
+		gol.Run(params, events, keyPresses)
+		golDone <- true
+	}()
+
+	tester := MakeTester(t, params, keyPresses, events, golDone)
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+
+		keyPresses <- 'k'
+		tester.TestKills()
+		tester.Stop(true)
+	}()
+
+	tester.Loop()
+}
+
+func testKeyboardPN(t *testing.T) {
+	params := gol.Params{
+		Turns:       100000000,
+		Threads:     8,
+		ImageWidth:  512,
+		ImageHeight: 512,
+	}
+
+	keyPresses := make(chan rune, 10)
+	events := make(chan gol.Event, 1000)
+
+	golDone := make(chan bool, 1)
+
+	go func() {
+		gol.Run(params, events, keyPresses)
+		golDone <- true
+	}()
+
+	tester := MakeTester(t, params, keyPresses, events, golDone)
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+
+		keyPresses <- 'p'
+		turn := tester.TestPauses()
+
+		// each press of n processes exactly one turn without resuming
+		keyPresses <- 'n'
+		keyPresses <- 'n'
+		keyPresses <- 'n'
+		tester.TestNoStateChange(500 * time.Millisecond)
+
+		// the world written on quitting is from the last turn stepped to
+		keyPresses <- 'q'
+		quit := tester.TestOutput()
+		assert(t, quit == turn+3, "Expected %v turns after stepping 3 times from turn %v, got %v", turn+3, turn, quit)
+		tester.TestQuits()
+		tester.Stop(true)
+	}()
+
+	tester.Loop()
+}
+
+func testKeyboardSpeed(t *testing.T) {
+	params := gol.Params{
+		Turns:       100000000,
+		Threads:     8,
+		ImageWidth:  512,
+		ImageHeight: 512,
+	}
+
+	keyPresses := make(chan rune, 10)
+	events := make(chan gol.Event, 1000)
+
+	golDone := make(chan bool, 1)
+
+	go func() {
+		gol.Run(params, events, keyPresses)
+		golDone <- true
+	}()
+
+	tester := MakeTester(t, params, keyPresses, events, golDone)
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+
+		// four presses of - leave 128ms between turns
+		for i := 0; i < 4; i++ {
+			keyPresses <- '-'
+		}
+		// the turns are counted between two snapshots a second apart
+		time.Sleep(200 * time.Millisecond)
+		keyPresses <- 's'
+		turn := tester.TestOutput()
+		time.Sleep(time.Second)
+		keyPresses <- 's'
+		slow := tester.TestOutput() - turn
+		assert(t, slow >= 4 && slow <= 10, "Expected about 8 turns in a second with a 128ms delay, got %v", slow)
+
+		// and four presses of + go back to full speed
+		for i := 0; i < 4; i++ {
+			keyPresses <- '+'
+		}
+		time.Sleep(200 * time.Millisecond)
+		keyPresses <- 's'
+		turn = tester.TestOutput()
+		time.Sleep(time.Second)
+		keyPresses <- 's'
+		fast := tester.TestOutput() - turn
+		assert(t, fast > 2*slow, "Expected more turns at full speed than %v, got %v", slow, fast)
+
+		keyPresses <- 'q'
+		tester.TestOutput()
+		tester.TestQuits()
+		tester.Stop(true)
+	}()
+
+	tester.Loop()
+}
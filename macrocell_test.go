@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestMacrocell tests reading and writing patterns in the macrocell format.
+func TestMacrocell(t *testing.T) {
+	t.Run("Position", testMacrocellPosition)
+	t.Run("Sparse", testMacrocellSparse)
+	t.Run("RoundTrip", testMacrocellRoundTrip)
+	t.Run("TooBig", testMacrocellTooBig)
+	t.Run("Invalid", testMacrocellInvalid)
+}
+
+func testMacrocellPosition(t *testing.T) {
+	// the glider is in the south east quadrant of the root, so its position in the world is kept
+	path := writePattern(t, "glider.mc", "[M2] (golly 4.2)\n#R B3/S23\n$$..*$...*$.***$\n4 0 0 0 1\n")
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, InputFile: path}
+	cells := runFinal(p)
+	assertEqualBoard(t, cells, gliderAt(1, 2), p)
+
+	// in the north west quadrant it is centred instead
+	path = writePattern(t, "glider.mc", "[M2] (golly 4.2)\n$$..*$...*$.***$\n4 1 0 0 0\n")
+	p.InputFile = path
+	cells = runFinal(p)
+	assertEqualBoard(t, cells, gliderAt(6, 6), p)
+
+	p.PatternOffset = &util.Cell{X: 2, Y: 10}
+	cells = runFinal(p)
+	assertEqualBoard(t, cells, gliderAt(2, 10), p)
+}
+
+func testMacrocellSparse(t *testing.T) {
+	// two gliders 2^41 cells apart would not fit in any world, but the same glider nested deep inside empty space does
+	var b strings.Builder
+	b.WriteString("[M2] (golly 4.2)\n$$..*$...*$.***$\n4 0 0 0 1\n")
+	for level := 5; level <= 41; level++ {
+		fmt.Fprintf(&b, "%v %v 0 0 0\n", level, level-3)
+	}
+	path := writePattern(t, "deep.mc", b.String())
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, InputFile: path}
+	cells := runFinal(p)
+	assertEqualBoard(t, cells, gliderAt(6, 6), p)
+
+	fmt.Fprintf(&b, "42 %v 0 0 %v\n", 41-2, 41-2)
+	p.InputFile = writePattern(t, "apart.mc", b.String())
+	expectRefused(t, p)
+}
+
+func testMacrocellRoundTrip(t *testing.T) {
+	for _, size := range []int{16, 64} {
+		for _, turns := range []int{0, 1, 100} {
+			t.Run(fmt.Sprintf("%dx%dx%d", size, size, turns), func(t *testing.T) {
+				emptyOutFolder()
+				p := gol.Params{Turns: turns, Threads: 4, ImageWidth: size, ImageHeight: size, OutputFormat: "mc"}
+				runFinal(p)
+
+				path := fmt.Sprintf("out/%vx%vx%v.mc", size, size, turns)
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert(t, strings.HasPrefix(string(data), "[M2] (gol)\n#R B3/S23\n"), "the output should start with [M2] and the rule, not %q", data)
+
+				// the size of the world is kept even if its edges are empty
+				width, height, err := gol.ImageSize(path)
+				assert(t, err == nil && width == size && height == size, "the size should be %vx%v, not %vx%v (%v)", size, size, width, height, err)
+				cells := runFinal(gol.Params{Threads: 4, InputFile: path})
+				expected := readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", size, size, turns), size, size)
+				assertEqualBoard(t, cells, expected, p)
+			})
+		}
+	}
+}
+
+func testMacrocellTooBig(t *testing.T) {
+	// single cells in opposite corners of the root are 8193 cells apart, just over the 8192x8192 limit
+	var b strings.Builder
+	b.WriteString("[M2] (golly 4.2)\n*$\n")
+	for level := 4; level <= 13; level++ {
+		fmt.Fprintf(&b, "%v %v 0 0 0\n", level, level-3)
+	}
+	b.WriteString("14 11 0 0 11\n")
+	path := writePattern(t, "corners.mc", b.String())
+
+	_, _, err := gol.ImageSize(path)
+	assert(t, err != nil, "reading the size of a pattern covering more than 8192x8192 cells should fail")
+
+	expectRefused(t, gol.Params{Threads: 4, InputFile: path})
+}
+
+func testMacrocellInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"header":   "$$..*$...*$.***$\n4 0 0 0 1\n",
+		"empty":    "[M2] (golly 4.2)\n#R B3/S23\n",
+		"leaf":     "[M2] (golly 4.2)\n$$..*$...*$.*o*$\n4 0 0 0 1\n",
+		"wide":     "[M2] (golly 4.2)\n.........*$\n4 0 0 0 1\n",
+		"quadrant": "[M2] (golly 4.2)\n$$..*$...*$.***$\n4 0 0 0 2\n",
+		"level":    "[M2] (golly 4.2)\n$$..*$...*$.***$\n5 0 0 0 1\n",
+		"fields":   "[M2] (golly 4.2)\n$$..*$...*$.***$\n4 0 0 1\n",
+		"rule":     "[M2] (golly 4.2)\n#R B9/S23\n$$..*$...*$.***$\n4 0 0 0 1\n",
+		"size":     "[M2] (golly 4.2)\n#C gol size: 16 by 16\n$$..*$...*$.***$\n4 0 0 0 1\n",
+	}
+	for name, data := range invalid {
+		t.Run(name, func(t *testing.T) {
+			expectRefused(t, gol.Params{ImageWidth: 16, ImageHeight: 16, InputFile: writePattern(t, "pattern.mc", data)})
+		})
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"uk.ac.bris.cs/gameoflife/gol"
 	"uk.ac.bris.cs/gameoflife/sdl"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
 // main is the function called when starting Game of Life with 'go run .'
@@ -41,6 +43,133 @@ func main() {
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
+	flag.StringVar(
+		&params.InputFile,
+		"input",
+		"",
+		"Specify a pgm or pbm image or a rle, cells, lif or mc pattern to load instead of images/<w>x<h>.pgm, which may be gzipped as .gz. Its size is used unless -w and -h are given. mc patterns may cover at most 8192x8192 cells.")
+
+	flag.Float64Var(
+		&params.Threshold,
+		"threshold",
+		0.5,
+		"Specify the fraction of the maximum pixel value at which a cell in the input image is alive. Defaults to 0.5.")
+
+	flag.Func(
+		"offset",
+		"Specify where to put the top left corner of a pattern file as x,y. Defaults to the centre of the world.",
+		func(s string) error {
+			var offset util.Cell
+			if _, err := fmt.Sscanf(s, "%d,%d", &offset.X, &offset.Y); err != nil {
+				return fmt.Errorf("offset should look like 10,20")
+			}
+			params.PatternOffset = &offset
+			return nil
+		})
+
+	flag.Func(
+		"output",
+		"Specify the format of output images, one of pgm, png, pbm, plainpbm, rle, cells, lif (Life 1.06) or mc (macrocell). Defaults to pgm.",
+		func(s string) error {
+			params.OutputFormat = s
+			return gol.CheckOutputFormat(s)
+		})
+
+	flag.Var(
+		&params.Engine,
+		"engine",
+		"Specify how the world is stored, one of bytes, packed or hashlife, which needs a square torus with a power of two size. Defaults to bytes.")
+
+	flag.Var(
+		&params.Rule,
+		"rule",
+		"Specify the rule in B/S notation, e.g. B36/S23 for HighLife. Defaults to B3/S23.")
+
+	flag.Var(
+		&params.Topology,
+		"topology",
+		"Specify what happens at the edges of the world, one of torus, plane, reflect, klein or cross. Defaults to torus.")
+
+	flag.DurationVar(
+		&params.ReportInterval,
+		"report",
+		2*time.Second,
+		"Specify how often the number of alive cells is reported, e.g. 500ms. Defaults to 2s.")
+
+	flag.IntVar(
+		&params.History,
+		"history",
+		100,
+		"Specify how many turns are kept for stepping backwards with b while paused, or 0 for none. Defaults to 100.")
+
+	flag.StringVar(
+		&params.Resume,
+		"resume",
+		"",
+		"Specify a checkpoint to carry on from. Its size, turns, threads, engine, rule and topology are used unless given explicitly.")
+
+	flag.DurationVar(
+		&params.CheckpointInterval,
+		"checkpoint",
+		0,
+		"Specify how often a checkpoint is written to out/<w>x<h>.checkpoint, e.g. 10m. Defaults to only when quitting with q.")
+
+	flag.IntVar(
+		&params.SnapshotEvery,
+		"snapshot-every",
+		0,
+		"Specify a number of turns after which the world is written to out/ in the output format each time. Defaults to only the final turn.")
+
+	flag.IntVar(
+		&params.RecordEvery,
+		"record-every",
+		0,
+		"Specify a number of turns after which a frame is recorded to out/<w>x<h>x<turns>.gif each time. Frames are written as they are recorded. Defaults to no recording.")
+
+	flag.IntVar(
+		&params.RecordScale,
+		"record-scale",
+		1,
+		"Specify how many pixels wide each cell is in the recording. Defaults to 1.")
+
+	flag.DurationVar(
+		&params.RecordDelay,
+		"record-delay",
+		100*time.Millisecond,
+		"Specify how long each frame of the recording is shown for, to the nearest 10ms and at least 10ms. Defaults to 100ms.")
+
+	flag.IntVar(
+		&params.PngScale,
+		"png-scale",
+		1,
+		"Specify how many pixels wide each cell is in png images. Defaults to 1.")
+
+	flag.Func(
+		"palette",
+		"Specify the colours of png images, one of grey, paper, green or age, which colours cells by how long they have been alive. Defaults to grey.",
+		func(s string) error {
+			params.Palette = s
+			return gol.CheckPalette(s)
+		})
+
+	flag.BoolVar(
+		&params.Compress,
+		"compress",
+		false,
+		"Compress images and checkpoints written to out/ with gzip, adding .gz to their names. Input files ending in .gz are always decompressed. Only gzip is supported, not zstd.")
+
+	flag.StringVar(
+		&params.Broker,
+		"broker",
+		"",
+		"Specify the address of a broker, e.g. localhost:8030, to process the turns on its workers instead of locally. The workers can not use the hashlife engine.")
+
+	flag.BoolVar(
+		&params.Attach,
+		"attach",
+		false,
+		"Attach to the simulation already running on the broker, which carries on by itself after q is pressed. Its size, engine, rule and topology are used, along with its turns unless given explicitly.")
+
 	headless := flag.Bool(
 		"headless",
 		false,
@@ -48,10 +177,109 @@ func main() {
 
 	flag.Parse()
 
+	// a History of zero in the params means the default, but -history 0 can only mean none
+	if params.History == 0 {
+		params.History = -1
+	}
+
+	// a checkpoint gives the size of the world, and any params not given explicitly
+	if params.Resume != "" {
+		saved, turn, err := gol.CheckpointParams(params.Resume)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		flagSet := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) {
+			flagSet[f.Name] = true
+		})
+		params.ImageWidth, params.ImageHeight = saved.ImageWidth, saved.ImageHeight
+		if !flagSet["turns"] {
+			params.Turns = saved.Turns
+		}
+		if !flagSet["t"] {
+			params.Threads = saved.Threads
+		}
+		if !flagSet["engine"] {
+			params.Engine = saved.Engine
+		}
+		if !flagSet["rule"] {
+			params.Rule = saved.Rule
+		}
+		if !flagSet["topology"] {
+			params.Topology = saved.Topology
+		}
+		fmt.Printf("%-10v %v from turn %v\n", "Resume", params.Resume, turn)
+	}
+
+	// the broker gives the size of the world, and any params not given explicitly
+	if params.Attach {
+		saved, turn, err := gol.BrokerParams(params.Broker)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		turnsSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "turns" {
+				turnsSet = true
+			}
+		})
+		params.ImageWidth, params.ImageHeight = saved.ImageWidth, saved.ImageHeight
+		params.Engine, params.Rule, params.Topology = saved.Engine, saved.Rule, saved.Topology
+		if !turnsSet {
+			params.Turns = saved.Turns
+		}
+		fmt.Printf("%-10v %v from turn %v\n", "Attach", params.Broker, turn)
+	}
+
+	// the size of an input image comes from its header, unless it was given explicitly
+	windowParams := params
+	if params.InputFile != "" && params.Resume == "" && !params.Attach {
+		widthSet, heightSet := false, false
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "w":
+				widthSet = true
+			case "h":
+				heightSet = true
+			}
+		})
+		if !widthSet || !heightSet {
+			width, height, err := gol.ImageSize(params.InputFile)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			// the SDL window has to be opened before gol has read the image
+			if !widthSet {
+				windowParams.ImageWidth = width
+			}
+			if !heightSet {
+				windowParams.ImageHeight = height
+			}
+			// gol reads the size itself if neither was given, but otherwise only the missing one is filled in
+			if !widthSet && !heightSet {
+				params.ImageWidth, params.ImageHeight = 0, 0
+			} else {
+				params.ImageWidth, params.ImageHeight = windowParams.ImageWidth, windowParams.ImageHeight
+			}
+		}
+	}
+
+	if params.InputFile != "" {
+		fmt.Printf("%-10v %v\n", "Input", params.InputFile)
+	}
+	if params.Broker != "" {
+		fmt.Printf("%-10v %v\n", "Broker", params.Broker)
+	}
 	fmt.Printf("%-10v %v\n", "Threads", params.Threads)
-	fmt.Printf("%-10v %v\n", "Width", params.ImageWidth)
-	fmt.Printf("%-10v %v\n", "Height", params.ImageHeight)
+	fmt.Printf("%-10v %v\n", "Width", windowParams.ImageWidth)
+	fmt.Printf("%-10v %v\n", "Height", windowParams.ImageHeight)
 	fmt.Printf("%-10v %v\n", "Turns", params.Turns)
+	fmt.Printf("%-10v %v\n", "Engine", params.Engine)
+	fmt.Printf("%-10v %v\n", "Rule", params.Rule)
+	fmt.Printf("%-10v %v\n", "Topology", params.Topology)
 
 	keyPresses := make(chan rune, 10)
 	events := make(chan gol.Event, 1000)
@@ -60,7 +288,7 @@ func main() {
 
 	go gol.Run(params, events, keyPresses)
 	if !(*headless) {
-		sdl.Run(params, events, keyPresses)
+		sdl.Run(windowParams, events, keyPresses)
 	} else {
 		sdl.RunHeadless(events)
 	}
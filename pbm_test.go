@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestPbm tests reading and writing the binary (P4) and plain (P1) pbm formats.
+func TestPbm(t *testing.T) {
+	t.Run("RoundTrip", testPbmRoundTrip)
+	t.Run("Input", testPbmInput)
+}
+
+func testPbmRoundTrip(t *testing.T) {
+	for _, format := range []string{"pbm", "plainpbm"} {
+		for _, size := range []int{16, 64, 128, 256, 512} {
+			t.Run(fmt.Sprintf("%v/%dx%d", format, size, size), func(t *testing.T) {
+				emptyOutFolder()
+				p := gol.Params{Turns: 0, Threads: 4, ImageWidth: size, ImageHeight: size, OutputFormat: format}
+				runFinal(p)
+
+				path := fmt.Sprintf("out/%vx%vx0.pbm", size, size)
+				if format == "pbm" {
+					info, err := os.Stat(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					// a bit for every cell and a short header
+					assert(t, info.Size() < int64(size*size/8+20), "%v should be about %v bytes, not %v", path, size*size/8, info.Size())
+				}
+
+				cells := runFinal(gol.Params{Threads: 4, InputFile: path})
+				expected := readAliveCells(fmt.Sprintf("images/%vx%v.pgm", size, size), size, size)
+				assertEqualBoard(t, cells, expected, p)
+			})
+		}
+	}
+}
+
+func testPbmInput(t *testing.T) {
+	// a glider in a 10x3 image, which has two bytes to a row when packed
+	glider := []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+	p := gol.Params{ImageWidth: 10, ImageHeight: 3}
+	valid := map[string]string{
+		"binary":    "P4\n# a comment\n10 3\n\x40\x00\x20\x00\xe0\x00",
+		"plain":     "P1\n10 3\n0 1 0 0 0 0 0 0 0 0\n0 0 1 0 0 0 0 0 0 0\n1 1 1 0 0 0 0 0 0 0\n",
+		"unspaced":  "P1 10 3 0100000000\n0010000000\n# a comment\n1110000000",
+		"extension": "P4 10 3 \x40\x00\x20\x00\xe0\x00",
+	}
+	for name, data := range valid {
+		t.Run(name, func(t *testing.T) {
+			filename := "image.pbm"
+			if name == "extension" {
+				// the format is read from the header rather than the extension
+				filename = "image.pgm"
+			}
+			path := writePattern(t, filename, data)
+			cells := runFinal(gol.Params{InputFile: path})
+			assertEqualBoard(t, cells, glider, p)
+		})
+	}
+
+	invalid := map[string]string{
+		"truncated": "P4\n10 3\n\x40\x00\x20",
+		"digit":     "P1\n10 3\n0100000002\n",
+		"short":     "P1\n10 3\n0100000000\n",
+	}
+	for name, data := range invalid {
+		t.Run(name, func(t *testing.T) {
+			path := writePattern(t, "image.pbm", data)
+			expectRefused(t, gol.Params{InputFile: path})
+		})
+	}
+}
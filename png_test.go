@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestPng tests writing png images with scaling and palettes.
+func TestPng(t *testing.T) {
+	t.Run("Palettes", testPngPalettes)
+	t.Run("Age", testPngAge)
+}
+
+func readPng(t *testing.T, path string) image.Image {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func rgba(img image.Image, x, y int) color.RGBA {
+	return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+}
+
+func testPngPalettes(t *testing.T) {
+	alive := map[string]color.RGBA{"grey": {255, 255, 255, 255}, "paper": {0, 0, 0, 255}}
+	for palette, aliveColour := range alive {
+		t.Run(palette, func(t *testing.T) {
+			emptyOutFolder()
+			p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16, OutputFormat: "png", PngScale: 4, Palette: palette}
+			runFinal(p)
+
+			img := readPng(t, "out/16x16x100.png")
+			bounds := img.Bounds()
+			if bounds.Dx() != 64 || bounds.Dy() != 64 {
+				t.Fatalf("ERROR: the image should be 64x64, not %vx%v", bounds.Dx(), bounds.Dy())
+			}
+			var cells []util.Cell
+			for y := 0; y < 16; y++ {
+				for x := 0; x < 16; x++ {
+					// every pixel of a cell is the same colour
+					c := rgba(img, x*4, y*4)
+					assert(t, c == rgba(img, x*4+3, y*4+3), "cell (%v, %v) should be a single colour", x, y)
+					if c == aliveColour {
+						cells = append(cells, util.Cell{X: x, Y: y})
+					}
+				}
+			}
+			assertEqualBoard(t, cells, readAliveCells("check/images/16x16x100.pgm", 16, 16), p)
+		})
+	}
+}
+
+func testPngAge(t *testing.T) {
+	emptyOutFolder()
+	// a block, which never changes, and a blinker, whose ends are born again every other turn
+	path := writePattern(t, "ages.cells", "OO\nOO\n\n\n\n\n.OOO\n")
+	p := gol.Params{Turns: 10, Threads: 4, ImageWidth: 16, ImageHeight: 16, InputFile: path, PatternOffset: &util.Cell{},
+		OutputFormat: "png", Palette: "age"}
+	runFinal(p)
+
+	img := readPng(t, fmt.Sprintf("out/16x16x%v.png", p.Turns))
+	block, centre, end := rgba(img, 0, 0), rgba(img, 2, 6), rgba(img, 1, 6)
+	newborn := color.RGBA{255, 255, 160, 255}
+	assert(t, end == newborn, "a cell born this turn should be %v, not %v", newborn, end)
+	assert(t, block == centre, "cells alive for the same number of turns should be the same colour, not %v and %v", block, centre)
+	assert(t, block != newborn && block != (color.RGBA{0, 0, 0, 255}), "a cell alive for 10 turns should be darker than a newborn one, not %v", block)
+}
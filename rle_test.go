@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRle tests reading and writing patterns in the run length encoded format.
+func TestRle(t *testing.T) {
+	t.Run("Offset", testRleOffset)
+	t.Run("Rule", testRleRule)
+	t.Run("RoundTrip", testRleRoundTrip)
+	t.Run("Invalid", testRleInvalid)
+}
+
+func testRleOffset(t *testing.T) {
+	path := writePattern(t, "glider.rle", glider)
+	p := gol.Params{ImageWidth: 16, ImageHeight: 16, InputFile: path}
+
+	// patterns are centred unless an offset is given
+	cells := runFinal(p)
+	assertEqualBoard(t, cells, gliderAt(6, 6), p)
+
+	p.PatternOffset = &util.Cell{X: 2, Y: 10}
+	cells = runFinal(p)
+	assertEqualBoard(t, cells, gliderAt(2, 10), p)
+
+	// without a size the world is as big as the pattern
+	cells = runFinal(gol.Params{InputFile: path})
+	assertEqualBoard(t, cells, gliderAt(0, 0), gol.Params{ImageWidth: 3, ImageHeight: 3})
+}
+
+func testRleRule(t *testing.T) {
+	// the HighLife replicator, which evolves differently under the rules of Conway
+	replicator := "x = 5, y = 5, rule = B36/S23\n2b3o$bo2bo$o3bo$o2bo$3o!\n"
+	path := writePattern(t, "replicator.rle", replicator)
+	p := gol.Params{Turns: 12, Threads: 4, ImageWidth: 32, ImageHeight: 32, InputFile: path, OutputFormat: "rle"}
+
+	emptyOutFolder()
+	cells := runFinal(p)
+	initial := []util.Cell{
+		{X: 15, Y: 13}, {X: 16, Y: 13}, {X: 17, Y: 13},
+		{X: 14, Y: 14}, {X: 17, Y: 14},
+		{X: 13, Y: 15}, {X: 17, Y: 15},
+		{X: 13, Y: 16}, {X: 16, Y: 16},
+		{X: 13, Y: 17}, {X: 14, Y: 17}, {X: 15, Y: 17},
+	}
+	expected := referenceRun(initial, gol.Params{Turns: 12, ImageWidth: 32, ImageHeight: 32, Rule: mustParseRule(t, "B36/S23")})
+	assertEqualBoard(t, cells, expected, p)
+
+	// the rule is written into the output
+	data, err := os.ReadFile("out/32x32x12.rle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert(t, strings.HasPrefix(string(data), "x = 32, y = 32, rule = B36/S23\n"), "the output should start with the size and rule, not %q", data)
+
+	// a rule given explicitly overrides the one in the file
+	p.Rule = gol.Conway
+	cells = runFinal(p)
+	expected = referenceRun(initial, gol.Params{Turns: 12, ImageWidth: 32, ImageHeight: 32})
+	assertEqualBoard(t, cells, expected, p)
+}
+
+func testRleRoundTrip(t *testing.T) {
+	for _, size := range []int{16, 64} {
+		for _, turns := range []int{0, 1, 100} {
+			t.Run(fmt.Sprintf("%dx%dx%d", size, size, turns), func(t *testing.T) {
+				emptyOutFolder()
+				p := gol.Params{Turns: turns, Threads: 4, ImageWidth: size, ImageHeight: size, OutputFormat: "rle"}
+				runFinal(p)
+
+				path := fmt.Sprintf("out/%vx%vx%v.rle", size, size, turns)
+				cells := runFinal(gol.Params{Threads: 4, InputFile: path})
+				expected := readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", size, size, turns), size, size)
+				assertEqualBoard(t, cells, expected, p)
+			})
+		}
+	}
+}
+
+func testRleInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"header":  "bob$2bo$3o!\n",
+		"size":    "x = three, y = 3\nbob$2bo$3o!\n",
+		"rule":    "x = 3, y = 3, rule = B9/S23\nbob$2bo$3o!\n",
+		"bounds":  "x = 2, y = 3\nbob$2bo$3o!\n",
+		"tag":     "x = 3, y = 3\nbob$2bz$3o!\n",
+		"unended": "x = 3, y = 3\nbob$2bo$3o\n",
+		"too big": "x = 32, y = 32\no!\n",
+		"no size": "x = 0, y = 0\n!\n",
+	}
+	for name, data := range invalid {
+		t.Run(name, func(t *testing.T) {
+			p := gol.Params{ImageWidth: 16, ImageHeight: 16, InputFile: writePattern(t, "pattern.rle", data)}
+			if name == "no size" {
+				p.ImageWidth, p.ImageHeight = 0, 0
+			}
+			expectRefused(t, p)
+		})
+	}
+}
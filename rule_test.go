@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRule tests parsing rulestrings and the behaviour of a few well known life-like rules.
+func TestRule(t *testing.T) {
+	t.Run("parse", testRuleParse)
+	t.Run("invalid", testRuleInvalid)
+	t.Run("conway", testRuleConway)
+	t.Run("highlife", testRuleHighLife)
+	t.Run("daynight", testRuleDayAndNight)
+	t.Run("seeds", testRuleSeeds)
+	t.Run("engines", testRuleEngines)
+}
+
+func testRuleParse(t *testing.T) {
+	tests := map[string]string{
+		"B3/S23":      "B3/S23",
+		"b36/s23":     "B36/S23",
+		"S23/B36":     "B36/S23",
+		"B3678S34678": "B3678/S34678",
+		"B2/S":        "B2/S",
+		"23/3":        "B3/S23",
+		" B0/S8 ":     "B0/S8",
+	}
+	for rulestring, expected := range tests {
+		rule, err := gol.ParseRule(rulestring)
+		if err != nil {
+			t.Errorf("ERROR: Failed to parse %q: %v", rulestring, err)
+			continue
+		}
+		assert(t, rule.String() == expected, "%q should be parsed as %v, not %v", rulestring, expected, rule)
+	}
+}
+
+func testRuleInvalid(t *testing.T) {
+	for _, rulestring := range []string{"", "B3", "S23", "B39/S23", "B3/S23/B4", "B3/X23", "3/23/4", "B/S", "23"} {
+		_, err := gol.ParseRule(rulestring)
+		assert(t, err != nil, "%q should not be a valid rulestring", rulestring)
+	}
+}
+
+// checkRule compares Rule.Next against the expected births and survivals for every neighbour count.
+func checkRule(t *testing.T, rule gol.Rule, birth, survival []int) {
+	for n := 0; n <= 8; n++ {
+		assert(t, rule.Next(false, n) == containsInt(birth, n),
+			"%v: dead cell with %v neighbours should have Next %v", rule, n, containsInt(birth, n))
+		assert(t, rule.Next(true, n) == containsInt(survival, n),
+			"%v: alive cell with %v neighbours should have Next %v", rule, n, containsInt(survival, n))
+	}
+}
+
+func containsInt(slice []int, n int) bool {
+	for _, m := range slice {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseRule(t *testing.T, rulestring string) gol.Rule {
+	rule, err := gol.ParseRule(rulestring)
+	if err != nil {
+		t.Fatalf("ERROR: Failed to parse %q: %v", rulestring, err)
+	}
+	return rule
+}
+
+func testRuleConway(t *testing.T) {
+	checkRule(t, gol.Rule{}, []int{3}, []int{2, 3})
+	checkRule(t, mustParseRule(t, "B3/S23"), []int{3}, []int{2, 3})
+	assert(t, gol.Rule{}.String() == "B3/S23", "The zero Rule should be B3/S23, not %v", gol.Rule{})
+}
+
+func testRuleHighLife(t *testing.T) {
+	checkRule(t, mustParseRule(t, "B36/S23"), []int{3, 6}, []int{2, 3})
+}
+
+func testRuleDayAndNight(t *testing.T) {
+	checkRule(t, mustParseRule(t, "B3678/S34678"), []int{3, 6, 7, 8}, []int{3, 4, 6, 7, 8})
+}
+
+func testRuleSeeds(t *testing.T) {
+	checkRule(t, mustParseRule(t, "B2/S"), []int{2}, nil)
+}
+
+// testRuleEngines checks that both engines agree with each other after 100 turns of each rule.
+func testRuleEngines(t *testing.T) {
+	for _, rulestring := range []string{"B36/S23", "B3678/S34678", "B2/S", "B1357/S1357"} {
+		var results [][]util.Cell
+		for _, engine := range []gol.Engine{gol.ByteEngine, gol.PackedEngine} {
+			p := gol.Params{
+				Turns:       100,
+				Threads:     4,
+				ImageWidth:  64,
+				ImageHeight: 64,
+				Engine:      engine,
+				Rule:        mustParseRule(t, rulestring),
+			}
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var cells []util.Cell
+			for event := range events {
+				if e, ok := event.(gol.FinalTurnComplete); ok {
+					cells = e.Alive
+				}
+			}
+			results = append(results, cells)
+		}
+		assert(t, checkEqualBoard(results[0], results[1]),
+			"%v: bytes engine has %v alive cells but packed engine has %v", rulestring, len(results[0]), len(results[1]))
+	}
+}
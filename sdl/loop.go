@@ -38,6 +38,16 @@ sdl:
 						keyPresses <- 'q'
 					case sdl.K_k:
 						keyPresses <- 'k'
+					case sdl.K_n:
+						keyPresses <- 'n'
+					case sdl.K_b:
+						keyPresses <- 'b'
+					case sdl.K_0, sdl.K_1, sdl.K_2, sdl.K_3, sdl.K_4, sdl.K_5, sdl.K_6, sdl.K_7, sdl.K_8, sdl.K_9:
+						keyPresses <- rune('0' + e.Keysym.Sym - sdl.K_0)
+					case sdl.K_PLUS, sdl.K_EQUALS, sdl.K_KP_PLUS:
+						keyPresses <- '+'
+					case sdl.K_MINUS, sdl.K_KP_MINUS:
+						keyPresses <- '-'
 					}
 				}
 			}
@@ -63,7 +73,7 @@ sdl:
 				fmt.Printf("Completed Turns %-8v %-20v Avg%+5v turns/sec\n", event.GetCompletedTurns(), event, avgTurns.Get(event.GetCompletedTurns()))
 			case gol.FinalTurnComplete:
 				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
-			case gol.ImageOutputComplete:
+			case gol.ImageOutputComplete, gol.WorkersRecovered:
 				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 			case gol.StateChange:
 				fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
@@ -83,7 +93,7 @@ func RunHeadless(events <-chan gol.Event) {
 			fmt.Printf("Completed Turns %-8v %-20v Avg%+5v turns/sec\n", event.GetCompletedTurns(), event, avgTurns.Get(event.GetCompletedTurns()))
 		case gol.FinalTurnComplete:
 			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), "Final Turn Complete")
-		case gol.ImageOutputComplete:
+		case gol.ImageOutputComplete, gol.WorkersRecovered:
 			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
 		case gol.StateChange:
 			fmt.Printf("Completed Turns %-8v %v\n", event.GetCompletedTurns(), event)
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestSnapshot tests writing the world every SnapshotEvery turns.
+func TestSnapshot(t *testing.T) {
+	for _, engine := range []gol.Engine{gol.ByteEngine, gol.PackedEngine, gol.HashLifeEngine} {
+		t.Run(engine.String(), func(t *testing.T) {
+			emptyOutFolder()
+			p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64, Engine: engine, SnapshotEvery: 30}
+			events := make(chan gol.Event, 1000)
+			go gol.Run(p, events, nil)
+
+			var turns []int
+			final := false
+			for event := range events {
+				switch e := event.(type) {
+				case gol.ImageOutputComplete:
+					assert(t, e.Filename == fmt.Sprintf("64x64x%v", e.CompletedTurns), "Filename is not correct")
+					assert(t, !final, "ImageOutputComplete for turn %v should be sent before FinalTurnComplete", e.CompletedTurns)
+					turns = append(turns, e.CompletedTurns)
+				case gol.FinalTurnComplete:
+					final = true
+				}
+			}
+			// the final turn is written once, as usual
+			expected := []int{30, 60, 90, 100}
+			assert(t, fmt.Sprint(turns) == fmt.Sprint(expected), "Expected ImageOutputComplete for turns %v, got %v", expected, turns)
+
+			initial := readAliveCells("images/64x64.pgm", 64, 64)
+			for _, turn := range expected {
+				snapshot := readAliveCells(fmt.Sprintf("out/64x64x%v.pgm", turn), 64, 64)
+				assertEqualBoard(t, snapshot, referenceRun(initial, gol.Params{Turns: turn, ImageWidth: 64, ImageHeight: 64}), p)
+			}
+		})
+	}
+}
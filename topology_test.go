@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestTopology compares every topology with both engines against a simple reference implementation.
+func TestTopology(t *testing.T) {
+	topologies := []gol.Topology{gol.Torus, gol.Plane, gol.Reflect, gol.KleinBottle, gol.CrossSurface}
+	sizes := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64},
+	}
+	for _, p := range sizes {
+		initial := readAliveCells(fmt.Sprintf("images/%vx%v.pgm", p.ImageWidth, p.ImageHeight), p.ImageWidth, p.ImageHeight)
+		for _, topology := range topologies {
+			p.Topology = topology
+			for _, turns := range []int{1, 10, 50} {
+				p.Turns = turns
+				expected := referenceRun(initial, p)
+				for _, engine := range []gol.Engine{gol.ByteEngine, gol.PackedEngine} {
+					p.Engine = engine
+					for _, threads := range []int{1, 3, 16} {
+						p.Threads = threads
+						testName := fmt.Sprintf("%v-%v-%dx%dx%d-%d", topology, engine, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+						t.Run(testName, func(t *testing.T) {
+							events := make(chan gol.Event)
+							go gol.Run(p, events, nil)
+							var cells []util.Cell
+							for event := range events {
+								if e, ok := event.(gol.FinalTurnComplete); ok {
+									cells = e.Alive
+								}
+							}
+							assertEqualBoard(t, cells, expected, p)
+						})
+					}
+				}
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -109,6 +110,174 @@ func readAliveCells(path string, width, height int) []util.Cell {
 	return cells
 }
 
+// runFinal runs the Game of Life and returns the alive cells reported by FinalTurnComplete.
+func runFinal(p gol.Params) []util.Cell {
+	events := make(chan gol.Event, 1000)
+	go gol.Run(p, events, nil)
+	var cells []util.Cell
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			cells = e.Alive
+		}
+	}
+	return cells
+}
+
+// expectRefused runs gol and checks that it quits without processing a single turn,
+// as it should when the params or the input file can not be used.
+func expectRefused(t *testing.T, p gol.Params) {
+	t.Helper()
+	events := make(chan gol.Event, 1000)
+	go gol.Run(p, events, nil)
+	quit := false
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete, gol.FinalTurnComplete:
+			t.Errorf("ERROR: %T should not be sent when the run is refused", e)
+		case gol.StateChange:
+			quit = e.NewState == gol.Quitting
+		}
+	}
+	assert(t, quit, "StateChange Quitting should be sent when the run is refused")
+}
+
+// runKeys runs gol with the given key presses already waiting, returning the turn and world of every
+// TurnComplete event followed by the final turn.
+func runKeys(t *testing.T, p gol.Params, keys string) ([]int, [][]util.Cell, int) {
+	keyPresses := make(chan rune, len(keys))
+	for _, key := range keys {
+		keyPresses <- key
+	}
+	events := make(chan gol.Event, 1000)
+	go gol.Run(p, events, keyPresses)
+
+	world := make(map[util.Cell]bool)
+	var turns []int
+	var worlds [][]util.Cell
+	final := -1
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellsFlipped:
+			for _, cell := range e.Cells {
+				world[cell] = !world[cell]
+			}
+		case gol.TurnComplete:
+			var alive []util.Cell
+			for cell, isAlive := range world {
+				if isAlive {
+					alive = append(alive, cell)
+				}
+			}
+			turns = append(turns, e.CompletedTurns)
+			worlds = append(worlds, alive)
+		case gol.FinalTurnComplete:
+			final = e.CompletedTurns
+			assertEqualBoard(t, e.Alive, worlds[len(worlds)-1], p)
+		}
+	}
+	return turns, worlds, final
+}
+
+// writePattern writes data to a file called name in a temporary directory and returns its path.
+func writePattern(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const glider = "#N Glider\n#C a comment\nx = 3, y = 3, rule = B3/S23\nbob$2bo$3o!\n"
+
+// gliderAt returns the cells of the glider in the glider pattern with its top left corner at x, y.
+func gliderAt(x, y int) []util.Cell {
+	return []util.Cell{{X: x + 1, Y: y}, {X: x + 2, Y: y + 1}, {X: x, Y: y + 2}, {X: x + 1, Y: y + 2}, {X: x + 2, Y: y + 2}}
+}
+
+// referenceRun processes the turns in p one cell at a time, as a check on the engines.
+func referenceRun(initial []util.Cell, p gol.Params) []util.Cell {
+	world := make([][]bool, p.ImageHeight)
+	for i := range world {
+		world[i] = make([]bool, p.ImageWidth)
+	}
+	for _, cell := range initial {
+		world[cell.Y][cell.X] = true
+	}
+	for turn := 0; turn < p.Turns; turn++ {
+		next := make([][]bool, p.ImageHeight)
+		for y := range next {
+			next[y] = make([]bool, p.ImageWidth)
+			for x := range next[y] {
+				neighbours := 0
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						if dx == 0 && dy == 0 {
+							continue
+						}
+						nx, ny, ok := referenceNeighbour(p.Topology, x+dx, y+dy, p.ImageWidth, p.ImageHeight)
+						if ok && world[ny][nx] {
+							neighbours++
+						}
+					}
+				}
+				next[y][x] = p.Rule.Next(world[y][x], neighbours)
+			}
+		}
+		world = next
+	}
+	var cells []util.Cell
+	for y := range world {
+		for x := range world[y] {
+			if world[y][x] {
+				cells = append(cells, util.Cell{X: x, Y: y})
+			}
+		}
+	}
+	return cells
+}
+
+// referenceNeighbour finds the cell at x, y which may be one cell beyond the edges of the world.
+// Crossing the left or right edge is handled before crossing the top or bottom edge.
+func referenceNeighbour(topology gol.Topology, x, y, width, height int) (int, int, bool) {
+	if x < 0 || x >= width {
+		switch topology {
+		case gol.Plane:
+			return 0, 0, false
+		case gol.Reflect:
+			x = clamp(x, width)
+		case gol.CrossSurface:
+			x = (x + width) % width
+			y = height - 1 - y
+		default:
+			x = (x + width) % width
+		}
+	}
+	if y < 0 || y >= height {
+		switch topology {
+		case gol.Plane:
+			return 0, 0, false
+		case gol.Reflect:
+			y = clamp(y, height)
+		case gol.KleinBottle, gol.CrossSurface:
+			y = (y + height) % height
+			x = width - 1 - x
+		default:
+			y = (y + height) % height
+		}
+	}
+	return x, y, true
+}
+
+func clamp(i, size int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= size {
+		return size - 1
+	}
+	return i
+}
+
 type Tester struct {
 	t            *testing.T
 	params       gol.Params
@@ -427,6 +596,22 @@ func (tester *Tester) TestQuits() {
 	}, "No StateChange Quitting events received in 2 seconds")
 }
 
+func (tester *Tester) TestKills() {
+	tester.t.Logf("Testing for StateChange Quitting event without any output")
+	timeout(tester.t, 2*time.Second, func() {
+		for e := range tester.eventWatcher {
+			switch e := e.(type) {
+			case gol.ImageOutputComplete, gol.FinalTurnComplete:
+				tester.t.Errorf("ERROR: %v event should not be sent after k is pressed", e)
+			case gol.StateChange:
+				if e.NewState == gol.Quitting {
+					return
+				}
+			}
+		}
+	}, "No StateChange Quitting events received in 2 seconds")
+}
+
 func (tester *Tester) TestNoStateChange(ddl time.Duration) {
 	change := make(chan gol.StateChange, 1)
 	stop := make(chan bool)
@@ -453,7 +638,8 @@ func (tester *Tester) TestNoStateChange(ddl time.Duration) {
 	}
 }
 
-func (tester *Tester) TestOutput() {
+// TestOutput checks the next image output, returning the turn it was written at or -1 if there was none.
+func (tester *Tester) TestOutput() int {
 	width, height := tester.params.ImageWidth, tester.params.ImageHeight
 	tester.t.Logf("Testing image output")
 
@@ -472,7 +658,7 @@ func (tester *Tester) TestOutput() {
 		"If this test is running in WSL2, please make sure the test is located within WSL2 file system rather than Windows! i.e. Your path must not start with /mnt/...")
 
 	if !completed {
-		return
+		return -1
 	}
 
 	eventTurn := <-turn
@@ -496,6 +682,7 @@ func (tester *Tester) TestOutput() {
 	alive := readAliveCells(path, width, height)
 
 	assert(tester.t, len(alive) == expected, "At turn %v expected %v alive cells in output PGM image, got %v instead", eventTurn, expected, len(alive))
+	return eventTurn
 }
 
 func timeout(t *testing.T, ddl time.Duration, f func(), msg string, a ...interface{}) bool {
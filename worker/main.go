@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// A worker calculates the next state of strips of the world for a broker, see the broker command.
+// Given a broker, the worker registers with it and deregisters again when interrupted.
+func main() {
+	port := flag.Int(
+		"port",
+		8031,
+		"Specify the port to serve the broker on.")
+
+	broker := flag.String(
+		"broker",
+		"",
+		"Specify the address of a running broker to register with.")
+
+	host := flag.String(
+		"host",
+		"localhost",
+		"Specify the host name that the broker and other workers can reach this worker at when registering.")
+
+	flag.Parse()
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%v", *port))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Worker listening on", l.Addr())
+	if *broker == "" {
+		if err := gol.ServeWorker(l); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- gol.ServeWorker(l)
+	}()
+	address := net.JoinHostPort(*host, fmt.Sprint(l.Addr().(*net.TCPAddr).Port))
+	if err := gol.RegisterWorker(*broker, address); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Registered with the broker at", *broker)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-served:
+		fmt.Println("Stopped serving the broker:", err)
+		os.Exit(1)
+	case <-interrupts:
+		// the broker only replies once the strip of this worker has been given to the others
+		if err := gol.DeregisterWorker(*broker, address); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Deregistered from the broker")
+	}
+}